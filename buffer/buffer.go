@@ -13,66 +13,267 @@ var (
 type Buffer struct {
 	Width, Height       int
 	Cursor              *Cursor
-	Tiles               []*Tile
+	Limits              Limits
+	AutoWrap            bool
+	DeferWrap           bool
+	Links               []string
+	Combined            []string
+	Journal             *Journal // nil if changes are not recorded
+	links               map[string]int
+	combined            map[string]int
+	rows                rowStore
 	maxWidth, maxHeight int
+	mode                int
+	origin              int
+	top, bottom         int
 }
 
 // New creates a new buffer of w x h Tiles. The maximum buffer width is set to
 // the supplied width w.
 func New(w, h int) *Buffer {
 	b := &Buffer{
-		Width:  w,
-		Height: h,
-		Cursor: NewCursor(0, 0),
-		Tiles:  make([]*Tile, w*h),
+		Width:    w,
+		Height:   h,
+		Cursor:   NewCursor(0, 0),
+		AutoWrap: true,
+		bottom:   h - 1,
 	}
-	b.Resize(w, h)
+	b.rows.grow(h)
 	return b
 }
 
 // Clear removes all Tiles from the screen
 func (b *Buffer) Clear() {
-	for o := range b.Tiles {
-		b.Tiles[o] = nil
-	}
+	b.clearRows(0, b.rows.n)
 }
 
 // ClearAt clears a tile at offset o
 func (b *Buffer) ClearAt(o int) {
-	if o < len(b.Tiles) {
-		b.Tiles[o] = nil
+	y, x := calc.DivMod(o, b.Width)
+	if row := b.rows.row(y); row != nil {
+		b.saveTile(x, y)
+		row[x] = Tile{}
 	}
 }
 
 // ClearFrom clears all Tiles from offset o
 func (b *Buffer) ClearFrom(o int) {
-	for l := len(b.Tiles); o < l; o++ {
-		b.Tiles[o] = nil
+	y, x := calc.DivMod(o, b.Width)
+	if row := b.rows.row(y); row != nil {
+		b.saveRows(y, 1)
+		clearTiles(row[x:])
+		b.setWrapped(y, false)
 	}
+	b.clearRows(y+1, b.rows.n)
 }
 
 // ClearTo clears all Tiles up until offset o
 func (b *Buffer) ClearTo(o int) {
-	for o = calc.MinInt(o, len(b.Tiles)); o >= 0; o-- {
-		b.Tiles[o] = nil
+	y, x := calc.DivMod(o, b.Width)
+	b.clearRows(0, y)
+	if row := b.rows.row(y); row != nil {
+		b.saveRows(y, 1)
+		clearTiles(row[:x+1])
+	}
+}
+
+func clearTiles(tiles []Tile) {
+	for i := range tiles {
+		tiles[i] = Tile{}
 	}
 }
 
-// Insert inserts n Tiles at offset o.
-func (b *Buffer) Insert(o, n int) {
-	p := make([]*Tile, n)
-	b.Tiles = append(b.Tiles[:o], append(p, b.Tiles[o:]...)...)
+// Copy returns a deep copy of the buffer, including the cursor. Changes to
+// the copy are not recorded.
+func (b *Buffer) Copy() *Buffer {
+	c := *b
+	c.Cursor = &Cursor{}
+	*c.Cursor = *b.Cursor
+	c.Links = append([]string(nil), b.Links...)
+	c.Combined = append([]string(nil), b.Combined...)
+	c.links = copyIndex(b.links)
+	c.combined = copyIndex(b.combined)
+	c.rows = b.rows.copy(b.Width)
+	c.Journal = nil
+	return &c
+}
+
+// Insert inserts n Tiles at offset o. Inserting whole rows at the start of a
+// row does not move any tiles, see InsertRows. An offset past the end of the
+// buffer inserts at the end.
+func (b *Buffer) Insert(o, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if o%b.Width == 0 && n%b.Width == 0 {
+		return b.InsertRows(o/b.Width, n/b.Width)
+	}
+	l := b.rows.n * b.Width
+	o = calc.MinInt(o, l)
+	if err := b.Check(l + n - 1); err != nil {
+		return err
+	}
+	b.saveRows(o/b.Width, (l+n-1)/b.Width+1-o/b.Width)
+	b.Expand(l + n - 1)
+	for i := l - 1; i >= o; i-- {
+		b.setTile(i+n, b.tile(i))
+	}
+	for i := o; i < o+n && i < l; i++ {
+		b.ClearAt(i)
+	}
+	return nil
+}
+
+// InsertRows inserts n empty rows before row y.
+func (b *Buffer) InsertRows(y, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if err := b.CheckPos(b.Width-1, calc.MaxInt(y, b.rows.n)+n-1); err != nil {
+		return err
+	}
+	b.insertRows(y, n)
+	return nil
 }
 
 // Expand buffer to fit offset o.
 func (b *Buffer) Expand(o int) *Buffer {
-	l := len(b.Tiles)
-	if l <= o {
-		b.Tiles = append(b.Tiles, make([]*Tile, o-l+1)...)
-	}
+	b.rows.grow(o/b.Width + 1)
 	return b
 }
 
+// Row returns the tiles of row y, or nil if nothing was written to the row.
+// The returned tiles may be modified, such changes are not recorded.
+func (b *Buffer) Row(y int) []Tile {
+	return b.rows.row(y)
+}
+
+// Tiles returns a copy of all tiles in the buffer, the tile at offset o is at
+// index o. Changing the returned tiles does not change the buffer, use Tile
+// or Row for that.
+func (b *Buffer) Tiles() []Tile {
+	tiles := make([]Tile, b.rows.n*b.Width)
+	b.rows.each(func(y int, row []Tile) {
+		copy(tiles[y*b.Width:], row)
+	})
+	return tiles
+}
+
+// Rows returns the number of rows in the buffer.
+func (b *Buffer) Rows() int {
+	return b.rows.n
+}
+
+// AddLink registers a hyperlink target and returns its link number, for use
+// in Tile.Link.
+func (b *Buffer) AddLink(uri string) int32 {
+	return intern(&b.Links, &b.links, uri)
+}
+
+// Link returns the hyperlink target of link number n, or an empty string if
+// there is no such link.
+func (b *Buffer) Link(n int32) string {
+	return lookup(b.Links, n)
+}
+
+// AddCombining registers a sequence of combining characters and returns its
+// number, for use in Tile.Combining.
+func (b *Buffer) AddCombining(s string) int32 {
+	return intern(&b.Combined, &b.combined, s)
+}
+
+// Combining returns the sequence of combining characters number n, or an
+// empty string if there is no such sequence.
+func (b *Buffer) Combining(n int32) string {
+	return lookup(b.Combined, n)
+}
+
+// Text returns the character of a tile with its combining characters as a
+// string. The text of the second tile of a wide character is empty.
+func (b *Buffer) Text(t *Tile) string {
+	switch {
+	case t.Rune == TILE_CONTINUATION:
+		return ""
+	case t.Combining == 0:
+		return string(t.Rune)
+	default:
+		return string(t.Rune) + b.Combining(t.Combining)
+	}
+}
+
+// intern adds s to the table and returns its 1-based number, strings that are
+// already in the table are reused.
+func intern(table *[]string, index *map[string]int, s string) int32 {
+	if n, ok := (*index)[s]; ok {
+		return int32(n)
+	}
+	if *index == nil {
+		*index = make(map[string]int)
+	}
+	*table = append(*table, s)
+	(*index)[s] = len(*table)
+	return int32(len(*table))
+}
+
+func lookup(table []string, n int32) string {
+	if n < 1 || int(n) > len(table) {
+		return ""
+	}
+	return table[n-1]
+}
+
+func copyIndex(index map[string]int) map[string]int {
+	c := make(map[string]int, len(index))
+	for k, v := range index {
+		c[k] = v
+	}
+	return c
+}
+
+// PutWide writes a double width character, that occupies two tiles. If the
+// character does not fit on the current line, the line is padded with a space
+// first.
+func (b *Buffer) PutWide(r rune) error {
+	last := b.Cursor.X >= b.Width-1 && !b.Cursor.PendingWrap
+	if last && b.AutoWrap {
+		if err := b.PutRune(' ', ' '); err != nil {
+			return err
+		}
+	}
+	if err := b.PutRune(r, 0); err != nil {
+		return err
+	}
+	if last && !b.AutoWrap {
+		// No room for the second half
+		return nil
+	}
+	return b.PutRune(TILE_CONTINUATION, 0)
+}
+
+// Combine adds a zero-width combining character to the character before the
+// cursor. It is ignored if there is no such character on the current line.
+func (b *Buffer) Combine(r rune) error {
+	x := b.Cursor.X
+	if !b.Cursor.PendingWrap {
+		x--
+	}
+	if x < 0 {
+		return nil
+	}
+	row := b.rows.row(b.Cursor.Y)
+	if row == nil || x >= len(row) {
+		return nil
+	}
+	if row[x].Rune == TILE_CONTINUATION && x > 0 {
+		x--
+	}
+	if t := &row[x]; !t.Unset() {
+		b.saveTile(x, b.Cursor.Y)
+		t.Combining = b.AddCombining(b.Combining(t.Combining) + string(r))
+	}
+	return nil
+}
+
 // Len returns the number of possible Tiles (total offset)
 func (b *Buffer) Len() int {
 	return b.Width * b.Height
@@ -85,12 +286,6 @@ func (b *Buffer) Normalize() *Buffer {
 	return b
 }
 
-// Resize to at least a w x h canvas. If w exceeds the maximum buffer width an
-// error is thrown.
-func (b *Buffer) Resize(w, h int) (*Buffer, error) {
-	return nil, errors.New("Not implemented")
-}
-
 // Size calculates the allocated buffer size.
 func (b *Buffer) Size() (w int, h int) {
 	var l int
@@ -108,27 +303,105 @@ func (b *Buffer) SizeMax() (int, int) {
 }
 
 // Tile at offset o, will allocate a new Tile if it doesn't exist at the
-// requested offset.
+// requested offset. The tile is recorded as changed.
 func (b *Buffer) Tile(o int) *Tile {
-	if o >= len(b.Tiles) {
+	y, x := calc.DivMod(o, b.Width)
+	if y >= b.rows.n {
 		return nil
 	}
-	if b.Tiles[o] == nil {
-		b.Tiles[o] = NewTile()
+	b.saveTile(x, y)
+	t := &b.rows.touch(y, b.Width)[x]
+	if t.Unset() {
+		t.Reset()
+	}
+	return t
+}
+
+// tile returns the tile at offset o, without allocating.
+func (b *Buffer) tile(o int) Tile {
+	y, x := calc.DivMod(o, b.Width)
+	if row := b.rows.row(y); row != nil {
+		return row[x]
+	}
+	return Tile{}
+}
+
+// setTile sets the tile at offset o, without allocating unset tiles.
+func (b *Buffer) setTile(o int, t Tile) {
+	y, x := calc.DivMod(o, b.Width)
+	if row := b.rows.row(y); row != nil {
+		row[x] = t
+	} else if !t.Unset() {
+		b.rows.touch(y, b.Width)[x] = t
 	}
-	return b.Tiles[o]
 }
 
 // PutChar writes a character to the buffer at the current cursor location and
-// advances the cursor position.
+// advances the cursor position. The character is stored as an ISO 8859-1 rune,
+// use PutRune to store characters from other code pages.
 func (b *Buffer) PutChar(c byte) error {
-	b.Cursor.Char = c
+	return b.PutRune(rune(c), c)
+}
+
+// PutRune writes a decoded character and the original code page character c to
+// the buffer at the current cursor location and advances the cursor position.
+// An error is returned if the buffer limits are exceeded.
+func (b *Buffer) PutRune(r rune, c byte) error {
+	if b.Cursor.PendingWrap {
+		b.setWrapped(b.Cursor.Y, true)
+		b.Cursor.X = 0
+		b.LineFeed()
+		b.Cursor.PendingWrap = false
+	}
+	if r == 0 {
+		// A zero rune marks an unset tile
+		r = ' '
+	}
+	b.Cursor.Rune, b.Cursor.Char = r, c
+	if !b.AutoWrap {
+		b.Cursor.X = calc.MinInt(b.Cursor.X, b.Width-1)
+	}
+	if err := b.CheckPos(b.Cursor.X, b.Cursor.Y); err != nil {
+		return err
+	}
 	o := b.Cursor.Offset(b.Width)
 	t := b.Expand(o).Tile(o)
 	t.Update(&b.Cursor.Tile)
+	y, x := calc.DivMod(o, b.Width)
+	b.maxWidth = calc.MaxInt(b.maxWidth, x+1)
+	b.maxHeight = calc.MaxInt(b.maxHeight, y+1)
 	b.Cursor.X++
-	b.Cursor.NormalizeAndWrap(b.Width)
-	b.maxWidth = calc.MaxInt(b.maxWidth, b.Cursor.X)
-	b.maxHeight = calc.MaxInt(b.maxHeight, b.Cursor.Y)
+	switch {
+	case !b.AutoWrap:
+		b.Cursor.X = calc.MinInt(b.Cursor.X, b.Width-1)
+	case b.DeferWrap && b.Cursor.X == b.Width:
+		b.Cursor.X = b.Width - 1
+		b.Cursor.PendingWrap = true
+	case b.mode == MODE_SCREEN:
+		if b.Cursor.X >= b.Width {
+			b.setWrapped(b.Cursor.Y, true)
+			b.Cursor.X = 0
+			b.LineFeed()
+		}
+	default:
+		if b.Cursor.X >= b.Width {
+			b.setWrapped(b.Cursor.Y, true)
+		}
+		b.Cursor.NormalizeAndWrap(b.Width)
+	}
 	return nil
 }
+
+// Wrapped checks if the text on row y continues on the next row, because the
+// cursor wrapped automatically at the end of the row.
+func (b *Buffer) Wrapped(y int) bool {
+	return b.rows.wrapped(y)
+}
+
+// setWrapped sets if the text on row y continues on the next row.
+func (b *Buffer) setWrapped(y int, wrapped bool) {
+	if b.rows.wrapped(y) != wrapped {
+		b.saveWrap(y)
+		b.rows.wrap(y, b.Width, wrapped)
+	}
+}
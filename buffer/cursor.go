@@ -4,6 +4,12 @@ import "github.com/tehmaze-labs/go-piece/calc"
 
 type Cursor struct {
 	X, Y int
+
+	// PendingWrap is set if a character was written in the last column and
+	// the wrap to the next line is deferred until the next character is
+	// written. Moving the cursor clears the flag.
+	PendingWrap bool
+
 	Tile
 }
 
@@ -22,6 +28,7 @@ func (c *Cursor) Advance(w int) *Cursor {
 
 // Goto moves the cursor to the requested coordinates.
 func (c *Cursor) Goto(x, y int) *Cursor {
+	c.PendingWrap = false
 	c.X = calc.MaxInt(0, x)
 	c.Y = calc.MaxInt(0, y)
 	return c
@@ -48,18 +55,22 @@ func (c *Cursor) Pos() (int, int) {
 }
 
 func (c *Cursor) Up(i int) {
+	c.PendingWrap = false
 	c.Y = calc.MaxInt(0, c.Y-i)
 }
 
 func (c *Cursor) Down(i int) {
+	c.PendingWrap = false
 	c.Y += i
 }
 
 func (c *Cursor) Left(i int) {
+	c.PendingWrap = false
 	c.X = calc.MaxInt(0, c.X-i)
 }
 
 func (c *Cursor) Right(i int) {
+	c.PendingWrap = false
 	c.X += i
 }
 
@@ -0,0 +1,283 @@
+package buffer
+
+// Journal records the changes to the tiles of a buffer in groups, that are
+// undone and redone as a whole. The cursor, the buffer size and the scroll
+// region are restored to their state at the start or the end of a group.
+// Changes made through the tiles returned by Row are not recorded.
+type Journal struct {
+	// Limit is the maximum number of groups that can be undone, older groups
+	// are discarded. Zero means no limit.
+	Limit int
+
+	undo, redo []*group
+	open       *group // group that receives new changes
+}
+
+// group is a group of changes, with the buffer state before and after the
+// changes were made.
+type group struct {
+	changes       []change
+	before, after state
+}
+
+// state is the part of the buffer that is restored at the group boundaries.
+type state struct {
+	cursor              Cursor
+	width, height       int
+	rows                int
+	maxWidth, maxHeight int
+	mode, origin        int
+	top, bottom         int
+}
+
+// change is a recorded change. Applying a change reverts it, apply returns the
+// change that reverts it again.
+type change interface {
+	apply(b *Buffer) change
+}
+
+// Record starts recording the changes to the buffer in a new journal.
+func (b *Buffer) Record() *Journal {
+	b.Journal = &Journal{open: &group{before: b.state()}}
+	return b.Journal
+}
+
+// Group ends the current group of changes, following changes are recorded in
+// a new group. It does nothing if changes are not recorded.
+func (b *Buffer) Group() *Buffer {
+	if j := b.Journal; j != nil {
+		j.close(b)
+		j.open = &group{before: b.state()}
+	}
+	return b
+}
+
+// Undo reverts the last group of changes. It returns false if there is
+// nothing to undo.
+func (b *Buffer) Undo() bool {
+	j := b.Journal
+	if j == nil {
+		return false
+	}
+	j.close(b)
+	if len(j.undo) == 0 {
+		j.open = &group{before: b.state()}
+		return false
+	}
+	g := j.undo[len(j.undo)-1]
+	j.undo = j.undo[:len(j.undo)-1]
+	g.changes = b.revert(g.changes)
+	b.restore(g.before)
+	j.redo = append(j.redo, g)
+	j.open = &group{before: g.before}
+	return true
+}
+
+// Redo makes the last group of changes that was undone again. It returns
+// false if there is nothing to redo.
+func (b *Buffer) Redo() bool {
+	j := b.Journal
+	if j == nil {
+		return false
+	}
+	j.close(b)
+	if len(j.redo) == 0 {
+		j.open = &group{before: b.state()}
+		return false
+	}
+	g := j.redo[len(j.redo)-1]
+	j.redo = j.redo[:len(j.redo)-1]
+	g.changes = b.revert(g.changes)
+	b.restore(g.after)
+	j.undo = append(j.undo, g)
+	j.open = &group{before: g.after}
+	return true
+}
+
+// close moves the open group to the undo list, if it has any changes.
+func (j *Journal) close(b *Buffer) {
+	g := j.open
+	j.open = nil
+	if g == nil || len(g.changes) == 0 {
+		return
+	}
+	g.after = b.state()
+	j.undo = append(j.undo, g)
+	if j.Limit > 0 && len(j.undo) > j.Limit {
+		n := copy(j.undo, j.undo[len(j.undo)-j.Limit:])
+		for i := n; i < len(j.undo); i++ {
+			j.undo[i] = nil
+		}
+		j.undo = j.undo[:n]
+	}
+}
+
+// record adds a change to the open group. Recording a change discards the
+// groups that were undone.
+func (b *Buffer) record(c change) {
+	j := b.Journal
+	if j == nil {
+		return
+	}
+	if j.open == nil {
+		j.open = &group{before: b.state()}
+	}
+	j.open.changes = append(j.open.changes, c)
+	j.redo = nil
+}
+
+// revert applies the changes in reverse order, and returns the changes that
+// revert them again.
+func (b *Buffer) revert(changes []change) []change {
+	n := len(changes)
+	r := make([]change, n)
+	for i := range changes {
+		r[i] = changes[n-1-i].apply(b)
+	}
+	return r
+}
+
+func (b *Buffer) state() state {
+	return state{
+		cursor:    *b.Cursor,
+		width:     b.Width,
+		height:    b.Height,
+		rows:      b.rows.n,
+		maxWidth:  b.maxWidth,
+		maxHeight: b.maxHeight,
+		mode:      b.mode,
+		origin:    b.origin,
+		top:       b.top,
+		bottom:    b.bottom,
+	}
+}
+
+func (b *Buffer) restore(s state) {
+	*b.Cursor = s.cursor
+	b.Width, b.Height = s.width, s.height
+	if b.rows.n > s.rows {
+		b.rows.remove(s.rows, b.rows.n-s.rows)
+	} else {
+		b.rows.grow(s.rows)
+	}
+	b.maxWidth, b.maxHeight = s.maxWidth, s.maxHeight
+	b.mode, b.origin = s.mode, s.origin
+	b.top, b.bottom = s.top, s.bottom
+}
+
+// saveTile records the tile at column x, row y before it is changed.
+func (b *Buffer) saveTile(x, y int) {
+	if b.Journal == nil {
+		return
+	}
+	var t Tile
+	if row := b.rows.row(y); row != nil {
+		t = row[x]
+	}
+	b.record(tileChange{x, y, t})
+}
+
+// saveRows records a copy of n rows starting at row y before they are changed.
+func (b *Buffer) saveRows(y, n int) {
+	if b.Journal == nil {
+		return
+	}
+	rows := b.rows.slice(y, n)
+	for i, l := range rows {
+		if l.tiles != nil {
+			rows[i].tiles = append([]Tile(nil), l.tiles...)
+		}
+	}
+	b.record(rowsChange{y, rows})
+}
+
+// saveWrap records if row y continues on the next row, before it is changed.
+func (b *Buffer) saveWrap(y int) {
+	if b.Journal != nil {
+		b.record(wrapChange{y, b.rows.wrapped(y)})
+	}
+}
+
+// tileChange sets the tile at column x, row y.
+type tileChange struct {
+	x, y int
+	t    Tile
+}
+
+func (c tileChange) apply(b *Buffer) change {
+	row := b.rows.row(c.y)
+	if row == nil {
+		if c.t.Unset() {
+			return c
+		}
+		row = b.rows.touch(c.y, b.Width)
+	}
+	r := tileChange{c.x, c.y, row[c.x]}
+	row[c.x] = c.t
+	return r
+}
+
+// wrapChange sets if row y continues on the next row.
+type wrapChange struct {
+	y       int
+	wrapped bool
+}
+
+func (c wrapChange) apply(b *Buffer) change {
+	r := wrapChange{c.y, b.rows.wrapped(c.y)}
+	b.rows.wrap(c.y, b.Width, c.wrapped)
+	return r
+}
+
+// rowsChange replaces the rows starting at row y.
+type rowsChange struct {
+	y    int
+	rows []line
+}
+
+func (c rowsChange) apply(b *Buffer) change {
+	r := rowsChange{c.y, b.rows.slice(c.y, len(c.rows))}
+	for i, l := range c.rows {
+		b.rows.set(c.y+i, l)
+	}
+	return r
+}
+
+// insertChange inserts rows before row y.
+type insertChange struct {
+	y    int
+	rows []line
+}
+
+func (c insertChange) apply(b *Buffer) change {
+	b.rows.insert(c.y, len(c.rows))
+	for i, l := range c.rows {
+		if l.tiles != nil {
+			b.rows.set(c.y+i, l)
+		}
+	}
+	return removeChange{c.y, len(c.rows)}
+}
+
+// removeChange removes n rows starting at row y.
+type removeChange struct {
+	y, n int
+}
+
+func (c removeChange) apply(b *Buffer) change {
+	r := insertChange{c.y, b.rows.slice(c.y, c.n)}
+	b.rows.remove(c.y, c.n)
+	return r
+}
+
+// storeChange replaces all rows and the size of the buffer.
+type storeChange struct {
+	rows          rowStore
+	width, height int
+}
+
+func (c storeChange) apply(b *Buffer) change {
+	r := storeChange{b.rows, b.Width, b.Height}
+	b.rows, b.Width, b.Height = c.rows, c.width, c.height
+	return r
+}
@@ -0,0 +1,176 @@
+package buffer
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// snapshot is the visible state of a buffer.
+type snapshot struct {
+	Width, Height int
+	Rows          int
+	MaxW, MaxH    int
+	Cursor        Cursor
+	Tiles         []Tile
+	Wrapped       []bool
+}
+
+func snap(b *Buffer) snapshot {
+	s := snapshot{
+		Width:  b.Width,
+		Height: b.Height,
+		Rows:   b.Rows(),
+		Cursor: *b.Cursor,
+		Tiles:  b.Tiles(),
+	}
+	s.MaxW, s.MaxH = b.SizeMax()
+	for y := 0; y < b.Rows(); y++ {
+		s.Wrapped = append(s.Wrapped, b.Wrapped(y))
+	}
+	return s
+}
+
+func write(b *Buffer, s string) {
+	for _, r := range s {
+		b.PutRune(r, byte(r))
+	}
+}
+
+func TestJournalUndoRedo(t *testing.T) {
+	text := "The quick brown fox jumps over the lazy dog"
+	tests := []struct {
+		name string
+		op   func(b *Buffer)
+	}{
+		{"PutRune", func(b *Buffer) { write(b, "hello") }},
+		{"PutRune wrapped", func(b *Buffer) { write(b, "0123456789abcdef") }},
+		{"PutWide", func(b *Buffer) { b.PutWide('世') }},
+		{"Combine", func(b *Buffer) { b.Combine('\u0301') }},
+		{"Insert", func(b *Buffer) { b.Insert(3, 4) }},
+		{"Insert rows", func(b *Buffer) { b.Insert(10, 20) }},
+		{"Insert past end", func(b *Buffer) { b.Insert(500, 3) }},
+		{"InsertRows", func(b *Buffer) { b.InsertRows(1, 2) }},
+		{"Delete tile", func(b *Buffer) { b.ClearAt(12) }},
+		{"Delete rect", func(b *Buffer) { b.ClearRect(Rect{2, 1, 5, 2}) }},
+		{"Delete rows", func(b *Buffer) { b.ClearRect(Rect{0, 1, 10, 2}) }},
+		{"Cut", func(b *Buffer) { b.CutRect(Rect{1, 0, 3, 3}) }},
+		{"Clear", func(b *Buffer) { b.Clear() }},
+		{"ClearFrom", func(b *Buffer) { b.ClearFrom(15) }},
+		{"ClearTo", func(b *Buffer) { b.ClearTo(15) }},
+		{"Fill", func(b *Buffer) { b.Fill(Rect{2, 2, 4, 8}, Tile{Rune: '#'}) }},
+		{"Paste", func(b *Buffer) { b.Paste(b.CopyRect(Rect{0, 0, 4, 2}), 5, 6, false) }},
+		{"ScrollUp", func(b *Buffer) { b.SetMode(MODE_SCREEN).SetMargins(1, 3).ScrollUp(1) }},
+		{"ScrollDown", func(b *Buffer) { b.ScrollDown(2) }},
+		{"Resize", func(b *Buffer) { b.Resize(6, 3) }},
+		{"Resize wider", func(b *Buffer) { b.Resize(20, 8) }},
+		{"Reflow", func(b *Buffer) { b.Reflow(7, 5) }},
+		{"Rotate", func(b *Buffer) { b.Rotate(true) }},
+		{"FlipHorizontal", func(b *Buffer) { b.FlipHorizontal() }},
+		{"Trim", func(b *Buffer) { b.Trim() }},
+		{"Insert and Resize", func(b *Buffer) {
+			b.Insert(5, 2)
+			b.Resize(12, 5)
+			write(b, "xyz")
+			b.ClearAt(0)
+		}},
+	}
+	for _, test := range tests {
+		b := New(10, 5)
+		write(b, text)
+		b.Record()
+		before := snap(b)
+		test.op(b)
+		after := snap(b)
+		if reflect.DeepEqual(before, after) {
+			t.Errorf("%s: buffer did not change", test.name)
+			continue
+		}
+		for i := 0; i < 2; i++ {
+			if !b.Undo() {
+				t.Fatalf("%s: nothing to undo", test.name)
+			}
+			if got := snap(b); !reflect.DeepEqual(got, before) {
+				t.Errorf("%s: undo %d:\nexpected %+v\ngot      %+v", test.name, i, before, got)
+			}
+			if !b.Redo() {
+				t.Fatalf("%s: nothing to redo", test.name)
+			}
+			if got := snap(b); !reflect.DeepEqual(got, after) {
+				t.Errorf("%s: redo %d:\nexpected %+v\ngot      %+v", test.name, i, after, got)
+			}
+		}
+	}
+}
+
+func TestJournalGroups(t *testing.T) {
+	b := New(10, 5)
+	b.Record()
+	var snaps []snapshot
+	for i := 0; i < 5; i++ {
+		snaps = append(snaps, snap(b))
+		write(b, fmt.Sprintf("step %d ", i))
+		b.Group()
+	}
+	final := snap(b)
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if !b.Undo() {
+			t.Fatalf("undo %d: nothing to undo", i)
+		}
+		if got := snap(b); !reflect.DeepEqual(got, snaps[i]) {
+			t.Errorf("undo %d: expected %+v, got %+v", i, snaps[i], got)
+		}
+	}
+	if b.Undo() {
+		t.Error("undo past the first group")
+	}
+	for b.Redo() {
+	}
+	if got := snap(b); !reflect.DeepEqual(got, final) {
+		t.Errorf("redo all: expected %+v, got %+v", final, got)
+	}
+
+	// Changes after an undo discard the redo groups
+	b.Undo()
+	write(b, "x")
+	if b.Redo() {
+		t.Error("redo after a new change")
+	}
+
+	// Empty groups are not recorded
+	b.Group().Group()
+	b.Goto(3, 3)
+	b.Group()
+	if !b.Undo() || b.Cursor.X == 3 {
+		t.Error("undo of a cursor move")
+	}
+}
+
+func TestJournalLimit(t *testing.T) {
+	b := New(10, 5)
+	b.Record().Limit = 3
+	for i := 0; i < 10; i++ {
+		write(b, "x")
+		b.Group()
+	}
+	var n int
+	for b.Undo() {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("expected 3 undo groups, got %d", n)
+	}
+}
+
+func TestJournalOff(t *testing.T) {
+	b := New(10, 5)
+	write(b, "x")
+	if b.Undo() || b.Redo() {
+		t.Error("undo without a journal")
+	}
+	b.Record()
+	write(b, "y")
+	if c := b.Copy(); c.Journal != nil {
+		t.Error("copy shares the journal")
+	}
+}
@@ -0,0 +1,68 @@
+package buffer
+
+// Layer is a buffer in a stack of layers, drawn with its top left corner at
+// column X, row Y.
+type Layer struct {
+	*Buffer
+	X, Y   int
+	Hidden bool // hidden layers are not drawn
+
+	// Transparent reports if a tile lets the layers below show through. If
+	// nil, only unset tiles are transparent.
+	Transparent func(t *Tile) bool
+}
+
+// TransparentBlank is a transparency rule that makes blank tiles, such as a
+// space with the default background, transparent.
+func TransparentBlank(t *Tile) bool {
+	return t.Blank()
+}
+
+// Layers is a stack of buffers that are composed into a single buffer when
+// flattened. Layers are drawn from the bottom (first) to the top (last).
+type Layers struct {
+	Width, Height int
+	Layers        []*Layer
+}
+
+// NewLayers creates an empty stack of layers for a w x h canvas.
+func NewLayers(w, h int) *Layers {
+	return &Layers{Width: w, Height: h}
+}
+
+// Add puts a buffer on top of the stack at column x, row y.
+func (l *Layers) Add(b *Buffer, x, y int) *Layer {
+	layer := &Layer{Buffer: b, X: x, Y: y}
+	l.Layers = append(l.Layers, layer)
+	return layer
+}
+
+// Remove takes a layer from the stack.
+func (l *Layers) Remove(layer *Layer) {
+	for i, o := range l.Layers {
+		if o == layer {
+			l.Layers = append(l.Layers[:i], l.Layers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Flatten composes the visible layers into a new buffer. Layers that extend
+// below the canvas make the buffer grow, parts of layers to the right of the
+// canvas are discarded. An error is returned if the buffer limits of the
+// bottom layer are exceeded.
+func (l *Layers) Flatten() (*Buffer, error) {
+	b := New(l.Width, l.Height)
+	if len(l.Layers) > 0 {
+		b.Limits = l.Layers[0].Limits
+	}
+	for _, layer := range l.Layers {
+		if layer.Hidden {
+			continue
+		}
+		if err := b.paste(layer.Buffer, layer.X, layer.Y, layer.Transparent); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
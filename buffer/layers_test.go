@@ -0,0 +1,54 @@
+package buffer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLayersFlatten(t *testing.T) {
+	bottom := []string{"abcd", "efgh"}
+	tests := []struct {
+		name  string
+		setup func(l *Layers)
+		want  []string
+	}{
+		{"bottom", func(l *Layers) {}, []string{"abcd", "efgh"}},
+		{"offset", func(l *Layers) { l.Add(draw("xy"), 1, 1) }, []string{"abcd", "exyh"}},
+		{"unset tiles", func(l *Layers) { l.Add(draw("x.y"), 0, 0) }, []string{"xbyd", "efgh"}},
+		{"blank tiles", func(l *Layers) { l.Add(draw("x y"), 0, 0) }, []string{"x yd", "efgh"}},
+		{"transparent", func(l *Layers) {
+			l.Add(draw("x y"), 0, 0).Transparent = TransparentBlank
+		}, []string{"xbyd", "efgh"}},
+		{"hidden", func(l *Layers) { l.Add(draw("xy"), 0, 0).Hidden = true }, []string{"abcd", "efgh"}},
+		{"removed", func(l *Layers) { l.Remove(l.Add(draw("xy"), 0, 0)) }, []string{"abcd", "efgh"}},
+		{"order", func(l *Layers) {
+			l.Add(draw("xx"), 0, 0)
+			l.Add(draw("y"), 1, 0)
+		}, []string{"xycd", "efgh"}},
+		{"right of the canvas", func(l *Layers) { l.Add(draw("xyz"), 3, 0) }, []string{"abcx", "efgh"}},
+		{"below the canvas", func(l *Layers) { l.Add(draw("x", "y"), 0, 2) }, []string{"abcd", "efgh", "x...", "y..."}},
+		{"left of the canvas", func(l *Layers) { l.Add(draw("xy"), -1, 0) }, []string{"ybcd", "efgh"}},
+	}
+	for _, test := range tests {
+		l := NewLayers(4, 2)
+		l.Add(draw(bottom...), 0, 0)
+		test.setup(l)
+		b, err := l.Flatten()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := text(b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestLayersLimits(t *testing.T) {
+	l := NewLayers(4, 2)
+	l.Add(draw("ab"), 0, 0).Limits = Limits{MaxHeight: 4}
+	l.Add(draw("x"), 0, 10)
+	if _, err := l.Flatten(); err == nil {
+		t.Error("expected a limit error")
+	}
+}
@@ -0,0 +1,61 @@
+package buffer
+
+import (
+	"fmt"
+
+	"github.com/tehmaze-labs/go-piece/calc"
+)
+
+// Limits restricts the resources a buffer may allocate. A zero value means
+// there is no limit.
+type Limits struct {
+	MaxWidth  int // maximum buffer width
+	MaxHeight int // maximum number of rows
+	MaxTiles  int // maximum number of allocated tiles
+}
+
+// LimitError is returned when an operation exceeds one of the limits.
+type LimitError struct {
+	Limit      string // name of the exceeded limit
+	Value, Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+// Check returns a LimitError if growing the buffer to fit offset o would
+// exceed the buffer limits. A negative offset is out of bounds.
+func (b *Buffer) Check(o int) error {
+	if o < 0 {
+		return errOutOfBounds
+	}
+	y, x := calc.DivMod(o, b.Width)
+	return b.CheckPos(x, y)
+}
+
+// CheckPos returns a LimitError if growing the buffer to fit column x, row y
+// would exceed the buffer limits. Columns past the width continue on the next
+// rows, like Cursor.Offset. Negative positions are out of bounds.
+func (b *Buffer) CheckPos(x, y int) error {
+	l := b.Limits
+	if x < 0 || y < 0 {
+		return errOutOfBounds
+	}
+	if y, x = y+x/b.Width, x%b.Width; y < 0 {
+		return errOutOfBounds
+	}
+	if l.MaxWidth > 0 && b.Width > l.MaxWidth {
+		return &LimitError{"width", int64(b.Width), int64(l.MaxWidth)}
+	}
+	if y < b.rows.n {
+		return nil
+	}
+	if l.MaxHeight > 0 && y >= l.MaxHeight {
+		return &LimitError{"height", int64(y) + 1, int64(l.MaxHeight)}
+	}
+	if l.MaxTiles > 0 && (y > l.MaxTiles/b.Width || y*b.Width+x >= l.MaxTiles) {
+		return &LimitError{"tiles", int64(y)*int64(b.Width) + int64(x) + 1, int64(l.MaxTiles)}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package buffer
+
+import "testing"
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxWidth: 1024, MaxHeight: 100, MaxTiles: 80 * 50}
+	tests := []struct {
+		name string
+		op   func(b *Buffer) error
+		ok   bool
+	}{
+		{"Check", func(b *Buffer) error { return b.Check(80*40 + 5) }, true},
+		{"Check negative", func(b *Buffer) error { return b.Check(-16) }, false},
+		{"Check tiles", func(b *Buffer) error { return b.Check(80 * 50) }, false},
+		{"CheckPos height", func(b *Buffer) error { return b.CheckPos(0, 100) }, false},
+		{"CheckPos overflow", func(b *Buffer) error { return b.CheckPos(0, 1<<62) }, false},
+		{"PutRune", func(b *Buffer) error {
+			b.Cursor.Y = 49
+			return b.PutRune('x', 'x')
+		}, true},
+		{"PutRune past the width", func(b *Buffer) error {
+			b.Cursor.X, b.Cursor.Y = 80*60, 0
+			return b.PutRune('x', 'x')
+		}, false},
+		{"PutRune far", func(b *Buffer) error {
+			b.Cursor.Y = 115292150460684699
+			return b.PutRune('x', 'x')
+		}, false},
+		{"InsertRows", func(b *Buffer) error { return b.InsertRows(0, 25) }, true},
+		{"InsertRows limit", func(b *Buffer) error { return b.InsertRows(0, 26) }, false},
+		{"InsertRows overflow", func(b *Buffer) error { return b.InsertRows(0, 115292150460684699) }, false},
+		{"Fill", func(b *Buffer) error { return b.Fill(Rect{0, 1 << 40, 1, 1}, Tile{Rune: 'x'}) }, false},
+		{"Insert", func(b *Buffer) error { return b.Insert(0, 1<<62) }, false},
+	}
+	for _, test := range tests {
+		b := New(80, 25)
+		b.Limits = limits
+		err := test.op(b)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %t, got error %v", test.name, test.ok, err)
+		}
+		if b.Rows() > limits.MaxHeight {
+			t.Errorf("%s: %d rows exceed the height limit", test.name, b.Rows())
+		}
+	}
+}
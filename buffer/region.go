@@ -0,0 +1,155 @@
+package buffer
+
+import "github.com/tehmaze-labs/go-piece/calc"
+
+// Rect is a rectangle of tiles, with the top left corner at column X, row Y.
+type Rect struct {
+	X, Y          int
+	Width, Height int
+}
+
+// Empty checks if the rectangle contains no tiles.
+func (r Rect) Empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+// Intersect returns the part of the rectangle that is inside s.
+func (r Rect) Intersect(s Rect) Rect {
+	x0, y0 := calc.MaxInt(r.X, s.X), calc.MaxInt(r.Y, s.Y)
+	x1 := calc.MinInt(r.X+r.Width, s.X+s.Width)
+	y1 := calc.MinInt(r.Y+r.Height, s.Y+s.Height)
+	if x1 <= x0 || y1 <= y0 {
+		return Rect{}
+	}
+	return Rect{x0, y0, x1 - x0, y1 - y0}
+}
+
+// Bounds returns the rectangle of all rows in the buffer.
+func (b *Buffer) Bounds() Rect {
+	return Rect{0, 0, b.Width, b.rows.n}
+}
+
+// CopyRect returns a new buffer with a copy of the tiles in r. Parts of r
+// outside the buffer are unset in the copy.
+func (b *Buffer) CopyRect(r Rect) *Buffer {
+	c := New(calc.MaxInt(r.Width, 1), calc.MaxInt(r.Height, 1))
+	c.Limits = b.Limits
+	c.Links = append([]string(nil), b.Links...)
+	c.Combined = append([]string(nil), b.Combined...)
+	c.links = copyIndex(b.links)
+	c.combined = copyIndex(b.combined)
+
+	s := r.Intersect(b.Bounds())
+	for y := s.Y; y < s.Y+s.Height; y++ {
+		if row := b.rows.row(y); row != nil {
+			copy(c.rows.touch(y-r.Y, c.Width)[s.X-r.X:], row[s.X:s.X+s.Width])
+		}
+	}
+	c.measure()
+	return c
+}
+
+// CutRect is like CopyRect, but also clears the tiles in r.
+func (b *Buffer) CutRect(r Rect) *Buffer {
+	c := b.CopyRect(r)
+	b.ClearRect(r)
+	return c
+}
+
+// ClearRect clears the tiles in r.
+func (b *Buffer) ClearRect(r Rect) {
+	r = r.Intersect(b.Bounds())
+	if r.Empty() {
+		return
+	}
+	if r.X == 0 && r.Width == b.Width {
+		b.clearRows(r.Y, r.Height)
+		return
+	}
+	b.saveRows(r.Y, r.Height)
+	for y := r.Y; y < r.Y+r.Height; y++ {
+		if row := b.rows.row(y); row != nil {
+			clearTiles(row[r.X : r.X+r.Width])
+			if r.X+r.Width == b.Width {
+				b.setWrapped(y, false)
+			}
+		}
+	}
+}
+
+// Fill sets the tiles in r to t. Parts of r to the right of the buffer are
+// ignored, the buffer grows downwards to fit r. An error is returned if the
+// buffer limits are exceeded.
+func (b *Buffer) Fill(r Rect, t Tile) error {
+	r = r.Intersect(Rect{0, 0, b.Width, r.Y + r.Height})
+	if r.Empty() {
+		return nil
+	}
+	if err := b.CheckPos(b.Width-1, r.Y+r.Height-1); err != nil {
+		return err
+	}
+	b.saveRows(r.Y, r.Height)
+	for y := r.Y; y < r.Y+r.Height; y++ {
+		row := b.rows.touch(y, b.Width)[r.X : r.X+r.Width]
+		for x := range row {
+			row[x] = t
+		}
+	}
+	b.grew(r)
+	return nil
+}
+
+// Paste draws the tiles of src with the top left corner at column x, row y.
+// Unset tiles in src are not drawn. If transparent is set, blank tiles are
+// not drawn either, see Tile.Blank. Parts of src to the right of the buffer
+// are ignored, the buffer grows downwards to fit src. An error is returned if
+// the buffer limits are exceeded.
+func (b *Buffer) Paste(src *Buffer, x, y int, transparent bool) error {
+	if transparent {
+		return b.paste(src, x, y, (*Tile).Blank)
+	}
+	return b.paste(src, x, y, nil)
+}
+
+// paste is like Paste, tiles for which skip returns true are not drawn.
+func (b *Buffer) paste(src *Buffer, x, y int, skip func(t *Tile) bool) error {
+	r := Rect{x, y, src.Width, src.rows.n}.Intersect(Rect{0, 0, b.Width, y + src.rows.n})
+	if r.Empty() {
+		return nil
+	}
+	if err := b.CheckPos(b.Width-1, r.Y+r.Height-1); err != nil {
+		return err
+	}
+	b.saveRows(r.Y, r.Height)
+	for sy := r.Y - y; sy < r.Y-y+r.Height; sy++ {
+		srow := src.rows.row(sy)
+		if srow == nil {
+			continue
+		}
+		var row []Tile
+		for sx := r.X - x; sx < r.X-x+r.Width; sx++ {
+			t := srow[sx]
+			if t.Unset() || skip != nil && skip(&t) {
+				continue
+			}
+			if row == nil {
+				row = b.rows.touch(sy+y, b.Width)
+			}
+			if t.Link != 0 {
+				t.Link = b.AddLink(src.Link(t.Link))
+			}
+			if t.Combining != 0 {
+				t.Combining = b.AddCombining(src.Combining(t.Combining))
+			}
+			row[sx+x] = t
+		}
+	}
+	b.grew(r)
+	return nil
+}
+
+// grew updates the used buffer size after drawing in r.
+func (b *Buffer) grew(r Rect) {
+	b.maxWidth = calc.MaxInt(b.maxWidth, r.X+r.Width)
+	b.maxHeight = calc.MaxInt(b.maxHeight, r.Y+r.Height)
+}
@@ -0,0 +1,96 @@
+package buffer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// draw returns a buffer with a row of tiles for each string, a dot is an
+// unset tile.
+func draw(rows ...string) *Buffer {
+	var w int
+	for _, row := range rows {
+		if n := len([]rune(row)); n > w {
+			w = n
+		}
+	}
+	b := New(w, len(rows))
+	b.rows.grow(len(rows))
+	for y, row := range rows {
+		for x, r := range []rune(row) {
+			if r != '.' {
+				b.rows.touch(y, w)[x] = Tile{Rune: r, Color: TILE_DEFAULT_COLOR}
+			}
+		}
+	}
+	b.measure()
+	return b
+}
+
+// text returns the rows of the buffer as strings, a dot is an unset tile.
+func text(b *Buffer) []string {
+	rows := make([]string, b.rows.n)
+	for y := range rows {
+		row := b.rows.row(y)
+		if row == nil {
+			rows[y] = strings.Repeat(".", b.Width)
+			continue
+		}
+		var s strings.Builder
+		for _, t := range row {
+			if t.Unset() {
+				s.WriteByte('.')
+			} else {
+				s.WriteRune(t.Rune)
+			}
+		}
+		rows[y] = s.String()
+	}
+	return rows
+}
+
+func TestRegion(t *testing.T) {
+	in := []string{
+		"abcd",
+		"efgh",
+		"ijkl",
+	}
+	tests := []struct {
+		name string
+		op   func(b *Buffer) *Buffer
+		want []string
+	}{
+		{"CopyRect", func(b *Buffer) *Buffer { return b.CopyRect(Rect{1, 1, 2, 2}) }, []string{"fg", "jk"}},
+		{"CopyRect outside", func(b *Buffer) *Buffer { return b.CopyRect(Rect{2, 2, 3, 2}) }, []string{"kl.", "..."}},
+		{"CutRect", func(b *Buffer) *Buffer {
+			b.CutRect(Rect{1, 0, 2, 2})
+			return b
+		}, []string{"a..d", "e..h", "ijkl"}},
+		{"ClearRect rows", func(b *Buffer) *Buffer {
+			b.ClearRect(Rect{0, 1, 4, 1})
+			return b
+		}, []string{"abcd", "....", "ijkl"}},
+		{"Fill", func(b *Buffer) *Buffer {
+			b.Fill(Rect{2, 1, 5, 3}, Tile{Rune: '#'})
+			return b
+		}, []string{"abcd", "ef##", "ij##", "..##"}},
+		{"Paste", func(b *Buffer) *Buffer {
+			b.Paste(draw("x.", " y"), 1, 1, false)
+			return b
+		}, []string{"abcd", "exgh", "i yl"}},
+		{"Paste transparent", func(b *Buffer) *Buffer {
+			b.Paste(draw("x.", " y"), 1, 1, true)
+			return b
+		}, []string{"abcd", "exgh", "ijyl"}},
+		{"Paste outside", func(b *Buffer) *Buffer {
+			b.Paste(draw("xyz"), 2, 3, false)
+			return b
+		}, []string{"abcd", "efgh", "ijkl", "..xy"}},
+	}
+	for _, test := range tests {
+		if got := text(test.op(draw(in...))); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package buffer
+
+import "github.com/tehmaze-labs/go-piece/calc"
+
+// Resize changes the buffer to a w x h canvas. Tiles keep their position,
+// tiles beyond the new width are discarded. Rows below the new height are
+// kept, as the canvas grows downwards when needed. An error is returned if
+// the new size exceeds the buffer limits.
+func (b *Buffer) Resize(w, h int) (*Buffer, error) {
+	if w < 1 || h < 1 {
+		return b, errOutOfBounds
+	}
+	if err := b.checkSize(w, calc.MaxInt(b.rows.n, h)); err != nil {
+		return b, err
+	}
+
+	rows := b.rows.copy(w)
+	rows.grow(h)
+	b.resized(w, h, rows)
+	b.Cursor.X = calc.MinInt(b.Cursor.X, w-1)
+	return b, nil
+}
+
+// Reflow is like Resize, but lines that continue on the next row are wrapped
+// again at the new width. Only rows that wrapped automatically continue on the
+// next row, see Wrapped. The cursor stays on the same character.
+func (b *Buffer) Reflow(w, h int) (*Buffer, error) {
+	if w < 1 || h < 1 {
+		return b, errOutOfBounds
+	}
+
+	var (
+		rows   rowStore
+		text   []Tile
+		cursor = b.Cursor.Offset(b.Width)
+		cx, cy = -1, -1
+		co     = -1 // cursor offset in the current line
+		y      int
+	)
+	flush := func() {
+		// Trim unused tiles at the end of the line
+		n := len(text)
+		for n > 0 && text[n-1].Blank() {
+			n--
+		}
+		var x int
+		for i, t := range text[:n] {
+			if x == w-1 && i+1 < n && text[i+1].Rune == TILE_CONTINUATION {
+				// Wide character does not fit, continue on the next row
+				rows.wrap(y, w, true)
+				x, y = 0, y+1
+			}
+			if i == co {
+				cx, cy = x, y
+			}
+			if !t.Unset() {
+				rows.touch(y, w)[x] = t
+			}
+			if x++; x == w && i+1 < n {
+				rows.wrap(y, w, true)
+				x, y = 0, y+1
+			}
+		}
+		if co >= n {
+			cx, cy = calc.MinInt(x+co-n, w-1), y
+		}
+		y++
+		text, co = text[:0], -1
+	}
+
+	for r := 0; r < b.rows.n; r++ {
+		row := b.rows.row(r)
+		if r == cursor/b.Width {
+			co = len(text) + cursor%b.Width
+		}
+		text = append(text, row...)
+		if !b.rows.wrapped(r) {
+			flush()
+		}
+	}
+	if len(text) > 0 {
+		flush()
+	}
+	if cy < 0 {
+		// Cursor below the content
+		cx, cy = calc.MinInt(b.Cursor.X, w-1), y+b.Cursor.Y-b.rows.n
+	}
+
+	if err := b.checkSize(w, calc.MaxInt(y, h)); err != nil {
+		return b, err
+	}
+	rows.grow(calc.MaxInt(y, h))
+	b.resized(w, h, rows)
+	b.Cursor.X, b.Cursor.Y = cx, calc.MaxInt(0, cy)
+	return b, nil
+}
+
+// checkSize checks if a canvas of w x h tiles is within the buffer limits.
+func (b *Buffer) checkSize(w, h int) error {
+	l := b.Limits
+	switch {
+	case l.MaxWidth > 0 && w > l.MaxWidth:
+		return &LimitError{"width", int64(w), int64(l.MaxWidth)}
+	case l.MaxHeight > 0 && h > l.MaxHeight:
+		return &LimitError{"height", int64(h), int64(l.MaxHeight)}
+	case l.MaxTiles > 0 && w*h > l.MaxTiles:
+		return &LimitError{"tiles", int64(w * h), int64(l.MaxTiles)}
+	}
+	return nil
+}
+
+// resized replaces the rows after a size change and resets the margins.
+func (b *Buffer) resized(w, h int, rows rowStore) {
+	if b.Journal != nil {
+		b.record(storeChange{b.rows, b.Width, b.Height})
+	}
+	b.Width, b.Height = w, h
+	b.rows = rows
+	b.top, b.bottom = 0, h-1
+	b.Cursor.PendingWrap = false
+	b.measure()
+}
+
+// measure recalculates the used buffer size.
+func (b *Buffer) measure() {
+	b.maxWidth, b.maxHeight = 0, 0
+	b.rows.each(func(y int, row []Tile) {
+		for x := len(row) - 1; x >= 0; x-- {
+			if !row[x].Unset() {
+				b.maxWidth = calc.MaxInt(b.maxWidth, x+1)
+				b.maxHeight = y + 1
+				break
+			}
+		}
+	})
+}
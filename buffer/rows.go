@@ -0,0 +1,279 @@
+package buffer
+
+import "github.com/tehmaze-labs/go-piece/calc"
+
+// ROW_CHUNK is the maximum number of rows in a chunk of the row store.
+const ROW_CHUNK = 64
+
+// chunk is a run of rows in the row store. A chunk without rows is a run of n
+// unset rows, that takes no memory.
+type chunk struct {
+	n    int
+	rows []line // nil for a run of unset rows
+}
+
+// line is a row in the store. A line without tiles is unset.
+type line struct {
+	tiles   []Tile
+	wrapped bool // the text continues on the next row
+}
+
+// rowStore keeps the rows of a buffer in chunks. Only the rows that are
+// written to are allocated, so the memory use does not depend on how far the
+// cursor moves, and rows are inserted or removed without copying tiles.
+type rowStore struct {
+	chunks []*chunk
+	n      int // number of rows
+
+	// Chunk that was found last, rows are mostly accessed in order
+	last, start int
+}
+
+// find returns the index and the first row of the chunk holding row y, with
+// y < s.n.
+func (s *rowStore) find(y int) (i, start int) {
+	if s.last < len(s.chunks) && s.start <= y {
+		i, start = s.last, s.start
+	}
+	for ; start+s.chunks[i].n <= y; i++ {
+		start += s.chunks[i].n
+	}
+	s.last, s.start = i, start
+	return
+}
+
+// splice replaces the chunk at index i with cs.
+func (s *rowStore) splice(i int, cs ...*chunk) {
+	tail := append(cs, s.chunks[i+1:]...)
+	s.chunks = append(s.chunks[:i], tail...)
+	s.last, s.start = 0, 0
+}
+
+// row returns row y, or nil if the row is unset.
+func (s *rowStore) row(y int) []Tile {
+	if y < 0 || y >= s.n {
+		return nil
+	}
+	i, start := s.find(y)
+	if c := s.chunks[i]; c.rows != nil {
+		return c.rows[y-start].tiles
+	}
+	return nil
+}
+
+// wrapped checks if row y continues on the next row.
+func (s *rowStore) wrapped(y int) bool {
+	if y < 0 || y >= s.n {
+		return false
+	}
+	i, start := s.find(y)
+	if c := s.chunks[i]; c.rows != nil {
+		return c.rows[y-start].wrapped
+	}
+	return false
+}
+
+// wrap sets if row y continues on the next row, a row of w tiles is allocated
+// if the row is unset.
+func (s *rowStore) wrap(y, w int, wrapped bool) {
+	if !wrapped && !s.wrapped(y) {
+		return
+	}
+	s.touch(y, w)
+	i, start := s.find(y)
+	s.chunks[i].rows[y-start].wrapped = wrapped
+}
+
+// touch returns row y, a row of w tiles is allocated if the row is unset.
+func (s *rowStore) touch(y, w int) []Tile {
+	s.grow(y + 1)
+	i, start := s.find(y)
+	c := s.chunks[i]
+	if c.rows != nil {
+		r := y - start
+		if c.rows[r].tiles == nil {
+			c.rows[r].tiles = make([]Tile, w)
+		}
+		return c.rows[r].tiles
+	}
+
+	row := make([]Tile, w)
+	r := y - start
+	if r == 0 && i > 0 {
+		if p := s.chunks[i-1]; p.rows != nil && p.n < ROW_CHUNK {
+			// Append to the previous chunk
+			p.rows = append(p.rows, line{tiles: row})
+			p.n++
+			if c.n--; c.n == 0 {
+				s.splice(i)
+			}
+			s.last, s.start = i-1, start-p.n+1
+			return row
+		}
+	}
+
+	// Split the run of unset rows
+	cs := make([]*chunk, 0, 3)
+	if r > 0 {
+		cs = append(cs, &chunk{n: r})
+	}
+	cs = append(cs, &chunk{n: 1, rows: []line{{tiles: row}}})
+	if after := c.n - r - 1; after > 0 {
+		cs = append(cs, &chunk{n: after})
+	}
+	s.splice(i, cs...)
+	s.last, s.start = i, y
+	if r > 0 {
+		s.last++
+	}
+	return row
+}
+
+// grow makes sure the store holds at least n rows.
+func (s *rowStore) grow(n int) {
+	if n <= s.n {
+		return
+	}
+	if l := len(s.chunks); l > 0 && s.chunks[l-1].rows == nil {
+		s.chunks[l-1].n += n - s.n
+	} else {
+		s.chunks = append(s.chunks, &chunk{n: n - s.n})
+	}
+	s.n = n
+}
+
+// insert inserts n unset rows before row y.
+func (s *rowStore) insert(y, n int) {
+	if n <= 0 {
+		return
+	}
+	if y >= s.n {
+		s.grow(y + n)
+		return
+	}
+	i, start := s.find(y)
+	c := s.chunks[i]
+	r := y - start
+	switch {
+	case c.rows == nil:
+		c.n += n
+	case r == 0 && i > 0 && s.chunks[i-1].rows == nil:
+		s.chunks[i-1].n += n
+	case r == 0:
+		s.splice(i, &chunk{n: n}, c)
+	default:
+		s.splice(i,
+			&chunk{n: r, rows: c.rows[:r:r]},
+			&chunk{n: n},
+			&chunk{n: c.n - r, rows: c.rows[r:]})
+	}
+	s.n += n
+	s.last, s.start = 0, 0
+}
+
+// remove removes n rows, starting at row y.
+func (s *rowStore) remove(y, n int) {
+	n = calc.MinInt(n, s.n-y)
+	if n <= 0 {
+		return
+	}
+	i, start := s.find(y)
+	for n > 0 {
+		c := s.chunks[i]
+		r := y - start
+		k := calc.MinInt(n, c.n-r)
+		if c.rows != nil {
+			c.rows = append(c.rows[:r], c.rows[r+k:]...)
+		}
+		c.n -= k
+		s.n -= k
+		n -= k
+		if c.n == 0 {
+			s.chunks = append(s.chunks[:i], s.chunks[i+1:]...)
+		} else {
+			start += c.n
+			i++
+		}
+		y = start
+	}
+	s.last, s.start = 0, 0
+}
+
+// clear unsets n rows, starting at row y.
+func (s *rowStore) clear(y, n int) {
+	n = calc.MinInt(n, s.n-y)
+	if n <= 0 {
+		return
+	}
+	i, start := s.find(y)
+	for ; n > 0; i++ {
+		c := s.chunks[i]
+		r := y - start
+		k := calc.MinInt(n, c.n-r)
+		if c.rows != nil {
+			for j := r; j < r+k; j++ {
+				c.rows[j] = line{}
+			}
+		}
+		n -= k
+		start += c.n
+		y = start
+	}
+}
+
+// each calls fn for all rows that are set.
+func (s *rowStore) each(fn func(y int, row []Tile)) {
+	var start int
+	for _, c := range s.chunks {
+		for r, l := range c.rows {
+			if l.tiles != nil {
+				fn(start+r, l.tiles)
+			}
+		}
+		start += c.n
+	}
+}
+
+// slice returns n rows starting at row y.
+func (s *rowStore) slice(y, n int) []line {
+	rows := make([]line, n)
+	for i := range rows {
+		if y+i < s.n {
+			j, start := s.find(y + i)
+			if c := s.chunks[j]; c.rows != nil {
+				rows[i] = c.rows[y+i-start]
+			}
+		}
+	}
+	return rows
+}
+
+// set replaces row y, a line without tiles unsets the row.
+func (s *rowStore) set(y int, l line) {
+	if l.tiles == nil {
+		s.clear(y, 1)
+		return
+	}
+	s.touch(y, 0)
+	i, start := s.find(y)
+	s.chunks[i].rows[y-start] = l
+}
+
+// copy returns a deep copy of the store, with rows of w tiles.
+func (s *rowStore) copy(w int) rowStore {
+	c := rowStore{n: s.n, chunks: make([]*chunk, len(s.chunks))}
+	for i, o := range s.chunks {
+		d := &chunk{n: o.n}
+		if o.rows != nil {
+			d.rows = make([]line, len(o.rows))
+			for r, l := range o.rows {
+				if l.tiles != nil {
+					d.rows[r] = line{make([]Tile, w), l.wrapped}
+					copy(d.rows[r].tiles, l.tiles)
+				}
+			}
+		}
+		c.chunks[i] = d
+	}
+	return c
+}
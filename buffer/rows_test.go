@@ -0,0 +1,197 @@
+package buffer
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/tehmaze-labs/go-piece/calc"
+)
+
+// dump returns the rows of the store as a string, with a dot for unset rows,
+// the first rune for set rows, and a plus after wrapped rows.
+func dump(s *rowStore) string {
+	var b strings.Builder
+	for y := 0; y < s.n; y++ {
+		if row := s.row(y); row == nil {
+			b.WriteByte('.')
+		} else {
+			b.WriteRune(row[0].Rune)
+		}
+		if s.wrapped(y) {
+			b.WriteByte('+')
+		}
+	}
+	return b.String()
+}
+
+// check verifies the chunk invariants of the store.
+func check(t *testing.T, s *rowStore) {
+	t.Helper()
+	var n int
+	for i, c := range s.chunks {
+		if c.n <= 0 {
+			t.Fatalf("chunk %d has %d rows", i, c.n)
+		}
+		if c.rows != nil && len(c.rows) != c.n {
+			t.Fatalf("chunk %d has %d rows, expected %d", i, len(c.rows), c.n)
+		}
+		if c.n > ROW_CHUNK && c.rows != nil {
+			t.Fatalf("chunk %d has %d rows, more than %d", i, c.n, ROW_CHUNK)
+		}
+		n += c.n
+	}
+	if n != s.n {
+		t.Fatalf("chunks hold %d rows, expected %d", n, s.n)
+	}
+}
+
+func put(s *rowStore, y int, r rune) {
+	s.touch(y, 4)[0].Rune = r
+}
+
+func TestRowStore(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(s *rowStore)
+		want string
+	}{
+		{"grow", func(s *rowStore) { s.grow(3) }, "..."},
+		{"touch", func(s *rowStore) { put(s, 1, 'a') }, ".a"},
+		{"touch in order", func(s *rowStore) {
+			put(s, 0, 'a')
+			put(s, 1, 'b')
+			put(s, 2, 'c')
+		}, "abc"},
+		{"touch in gap", func(s *rowStore) {
+			s.grow(5)
+			put(s, 4, 'b')
+			put(s, 2, 'a')
+		}, "..a.b"},
+		{"insert", func(s *rowStore) {
+			put(s, 0, 'a')
+			put(s, 1, 'b')
+			s.insert(1, 2)
+		}, "a..b"},
+		{"insert at end", func(s *rowStore) {
+			put(s, 0, 'a')
+			s.insert(3, 1)
+		}, "a..."},
+		{"remove", func(s *rowStore) {
+			put(s, 0, 'a')
+			put(s, 1, 'b')
+			put(s, 2, 'c')
+			s.remove(1, 1)
+		}, "ac"},
+		{"remove across chunks", func(s *rowStore) {
+			put(s, 0, 'a')
+			put(s, 3, 'b')
+			put(s, 5, 'c')
+			s.remove(1, 4)
+		}, "ac"},
+		{"remove past end", func(s *rowStore) {
+			put(s, 0, 'a')
+			put(s, 1, 'b')
+			s.remove(1, 10)
+		}, "a"},
+		{"clear", func(s *rowStore) {
+			put(s, 0, 'a')
+			put(s, 1, 'b')
+			put(s, 2, 'c')
+			s.clear(1, 5)
+		}, "a.."},
+		{"wrap", func(s *rowStore) {
+			s.grow(2)
+			s.wrap(0, 4, true)
+		}, " +."},
+		{"wrap moves with row", func(s *rowStore) {
+			put(s, 0, 'a')
+			s.wrap(0, 4, true)
+			s.insert(0, 1)
+		}, ".a+"},
+		{"clear unwraps", func(s *rowStore) {
+			put(s, 0, 'a')
+			s.wrap(0, 4, true)
+			s.clear(0, 1)
+		}, "."},
+		{"set", func(s *rowStore) {
+			s.grow(3)
+			s.set(1, line{tiles: []Tile{{Rune: 'x'}}, wrapped: true})
+			s.set(2, line{})
+		}, ".x+."},
+	}
+	for _, test := range tests {
+		var s rowStore
+		test.ops(&s)
+		check(t, &s)
+		if got := strings.ReplaceAll(dump(&s), "\x00", " "); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+// TestRowStoreModel compares random operations with a plain slice of rows.
+func TestRowStoreModel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var s rowStore
+	var model []rune // 0 for unset rows
+	for i := 0; i < 20000; i++ {
+		y, n := r.Intn(300), 1+r.Intn(20)
+		switch r.Intn(5) {
+		case 0, 1:
+			c := 'a' + rune(i%26)
+			put(&s, y, c)
+			for len(model) <= y {
+				model = append(model, 0)
+			}
+			model[y] = c
+		case 2:
+			s.insert(y, n)
+			if y >= len(model) {
+				for len(model) < y+n {
+					model = append(model, 0)
+				}
+			} else {
+				model = append(model[:y], append(make([]rune, n), model[y:]...)...)
+			}
+		case 3:
+			s.remove(y, n)
+			if y < len(model) {
+				model = append(model[:y], model[calc.MinInt(y+n, len(model)):]...)
+			}
+		case 4:
+			s.clear(y, n)
+			for j := y; j < y+n && j < len(model); j++ {
+				model[j] = 0
+			}
+		}
+		check(t, &s)
+
+		var want strings.Builder
+		for _, c := range model {
+			if c == 0 {
+				want.WriteByte('.')
+			} else {
+				want.WriteRune(c)
+			}
+		}
+		if got := dump(&s); got != want.String() {
+			t.Fatalf("operation %d: expected %q, got %q", i, want.String(), got)
+		}
+	}
+}
+
+func TestRowStoreCopy(t *testing.T) {
+	var s rowStore
+	put(&s, 0, 'a')
+	put(&s, 2, 'b')
+	s.wrap(2, 4, true)
+	c := s.copy(8)
+	put(&s, 0, 'x')
+	if got := dump(&c); got != "a.b+" {
+		t.Errorf("expected %q, got %q", "a.b+", got)
+	}
+	if n := len(c.row(0)); n != 8 {
+		t.Errorf("expected rows of 8 tiles, got %d", n)
+	}
+}
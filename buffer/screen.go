@@ -0,0 +1,240 @@
+package buffer
+
+import "github.com/tehmaze-labs/go-piece/calc"
+
+// Buffer modes
+const (
+	MODE_CANVAS = iota // infinite canvas, grows as the cursor moves down
+	MODE_SCREEN        // terminal screen of Height rows, with scrollback
+)
+
+// Mode returns the current buffer mode.
+func (b *Buffer) Mode() int {
+	return b.mode
+}
+
+// SetMode switches the buffer mode and resets the scroll region. When
+// switching to screen mode, the screen is positioned such that the cursor is
+// on the bottom row or above.
+func (b *Buffer) SetMode(m int) *Buffer {
+	b.mode = m
+	b.top, b.bottom = 0, b.Height-1
+	b.origin = 0
+	if m == MODE_SCREEN {
+		b.origin = calc.MaxInt(0, b.Cursor.Y-b.Height+1)
+	}
+	return b
+}
+
+// Scrollback returns the number of rows that have scrolled off the top of the
+// screen. The screen starts at this row in the buffer.
+func (b *Buffer) Scrollback() int {
+	return b.origin
+}
+
+// Margins returns the top and bottom row of the scroll region, relative to
+// the top of the screen.
+func (b *Buffer) Margins() (top, bottom int) {
+	return b.top, b.bottom
+}
+
+// SetMargins sets the scroll region to rows top up to and including bottom.
+// Invalid regions reset the scroll region to the full screen. The cursor is
+// moved to the home position.
+func (b *Buffer) SetMargins(top, bottom int) *Buffer {
+	if top < 0 || bottom >= b.Height || top >= bottom {
+		top, bottom = 0, b.Height-1
+	}
+	b.top, b.bottom = top, bottom
+	return b.Goto(0, 0)
+}
+
+// ScreenPos returns the cursor position relative to the top of the screen.
+func (b *Buffer) ScreenPos() (x, y int) {
+	return b.Cursor.X, b.Cursor.Y - b.origin
+}
+
+// Goto moves the cursor to column x, row y. In screen mode, the row is
+// relative to the top of the screen and limited to the screen height.
+func (b *Buffer) Goto(x, y int) *Buffer {
+	if b.mode == MODE_SCREEN {
+		x = calc.MinInt(x, b.Width-1)
+		y = b.origin + calc.MaxInt(0, calc.MinInt(y, b.Height-1))
+	}
+	b.Cursor.Goto(x, y)
+	return b
+}
+
+// Up moves the cursor up n rows. In screen mode, the cursor stops at the top
+// margin, or at the top of the screen if it was above the scroll region.
+func (b *Buffer) Up(n int) *Buffer {
+	if b.mode != MODE_SCREEN {
+		b.Cursor.Up(n)
+		return b
+	}
+	top := b.origin + b.top
+	if b.Cursor.Y < top {
+		top = b.origin
+	}
+	b.Cursor.Y = calc.MaxInt(top, b.Cursor.Y-n)
+	b.Cursor.PendingWrap = false
+	return b
+}
+
+// Down moves the cursor down n rows. In screen mode, the cursor stops at the
+// bottom margin, or at the bottom of the screen if it was below the scroll
+// region.
+func (b *Buffer) Down(n int) *Buffer {
+	if b.mode != MODE_SCREEN {
+		b.Cursor.Down(n)
+		return b
+	}
+	bottom := b.origin + b.bottom
+	if b.Cursor.Y > bottom {
+		bottom = b.origin + b.Height - 1
+	}
+	b.Cursor.Y = calc.MinInt(bottom, b.Cursor.Y+n)
+	b.Cursor.PendingWrap = false
+	return b
+}
+
+// Right moves the cursor right n columns. In screen mode, the cursor stops at
+// the right edge of the screen.
+func (b *Buffer) Right(n int) *Buffer {
+	b.Cursor.Right(n)
+	if b.mode == MODE_SCREEN {
+		b.Cursor.X = calc.MinInt(b.Cursor.X, b.Width-1)
+	}
+	return b
+}
+
+// CarriageReturn moves the cursor to the first column.
+func (b *Buffer) CarriageReturn() *Buffer {
+	return b.Column(0)
+}
+
+// Column moves the cursor to column x on the current row.
+func (b *Buffer) Column(x int) *Buffer {
+	if b.mode == MODE_SCREEN {
+		x = calc.MinInt(x, b.Width-1)
+	}
+	b.Cursor.X = calc.MaxInt(0, x)
+	b.Cursor.PendingWrap = false
+	return b
+}
+
+// LineFeed moves the cursor down one row. In screen mode, the scroll region
+// scrolls up if the cursor is on the bottom margin.
+func (b *Buffer) LineFeed() *Buffer {
+	if b.mode == MODE_SCREEN && b.Cursor.Y == b.origin+b.bottom {
+		b.Cursor.PendingWrap = false
+		return b.ScrollUp(1)
+	}
+	return b.Down(1)
+}
+
+// ScrollUp scrolls the contents of the scroll region up by n rows, inserting
+// blank rows at the bottom margin. In screen mode, if the scroll region spans
+// the entire screen, the rows that scroll off are kept in the scrollback.
+func (b *Buffer) ScrollUp(n int) *Buffer {
+	if n <= 0 {
+		return b
+	}
+	if b.mode == MODE_SCREEN && b.top == 0 && b.bottom == b.Height-1 {
+		b.origin += n
+		b.Cursor.Y += n
+		b.clearRows(b.origin+b.Height-n, n)
+		return b
+	}
+
+	s, e := b.region()
+	n = calc.MinInt(n, e-s)
+	b.removeRows(s, n)
+	b.insertRows(e-n, n)
+	return b
+}
+
+// ScrollDown scrolls the contents of the scroll region down by n rows,
+// inserting blank rows at the top margin. Rows that scroll past the bottom
+// margin are discarded.
+func (b *Buffer) ScrollDown(n int) *Buffer {
+	if n <= 0 {
+		return b
+	}
+
+	s, e := b.region()
+	n = calc.MinInt(n, e-s)
+	b.removeRows(e-n, n)
+	b.insertRows(s, n)
+	return b
+}
+
+// InsertLines inserts n blank rows at the cursor row. In screen mode, the rows
+// below the cursor move down within the scroll region and rows pushed past the
+// bottom margin are discarded, nothing happens if the cursor is outside the
+// scroll region. In canvas mode, the canvas grows. An error is returned if the
+// buffer limits are exceeded.
+func (b *Buffer) InsertLines(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if b.mode != MODE_SCREEN {
+		return b.InsertRows(b.Cursor.Y, n)
+	}
+
+	s, e := b.region()
+	if b.Cursor.Y < s || b.Cursor.Y >= e {
+		return nil
+	}
+	n = calc.MinInt(n, e-b.Cursor.Y)
+	b.removeRows(e-n, n)
+	b.insertRows(b.Cursor.Y, n)
+	return nil
+}
+
+// ClearScreen clears all Tiles on the screen. In screen mode, the scrollback
+// is preserved.
+func (b *Buffer) ClearScreen() {
+	if b.mode != MODE_SCREEN {
+		b.Clear()
+		return
+	}
+	b.clearRows(b.origin, b.Height)
+}
+
+// clearRows clears n rows starting at row y.
+func (b *Buffer) clearRows(y, n int) {
+	if n = calc.MinInt(n, b.rows.n-y); n <= 0 {
+		return
+	}
+	if b.Journal != nil {
+		// The cleared rows are no longer in the store, no need to copy them
+		b.record(rowsChange{y, b.rows.slice(y, n)})
+	}
+	b.rows.clear(y, n)
+}
+
+// insertRows inserts n unset rows before row y.
+func (b *Buffer) insertRows(y, n int) {
+	b.rows.insert(y, n)
+	if b.Journal != nil {
+		b.record(removeChange{y, n})
+	}
+}
+
+// removeRows removes n rows starting at row y.
+func (b *Buffer) removeRows(y, n int) {
+	if b.Journal != nil {
+		b.record(insertChange{y, b.rows.slice(y, n)})
+	}
+	b.rows.remove(y, n)
+}
+
+// region returns the first row and the row after the last row of the scroll
+// region, and expands the buffer to fit it.
+func (b *Buffer) region() (s, e int) {
+	s = b.origin + b.top
+	e = b.origin + b.bottom + 1
+	b.rows.grow(e)
+	return
+}
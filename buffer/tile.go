@@ -6,6 +6,9 @@ const (
 	TILE_DEFAULT_CHAR       = 0x20
 	TILE_DEFAULT_COLOR      = 0x07
 	TILE_DEFAULT_BACKGROUND = 0x00
+
+	// TILE_CONTINUATION is the Rune of the second tile of a wide character.
+	TILE_CONTINUATION = -1
 )
 
 const (
@@ -29,11 +32,16 @@ const (
 	ATTRIB_IDEOGRAM_STRESS_MARKING               // ideogram stress marking
 )
 
+// Tile is a character cell. Tiles are stored by value, the zero value is an
+// unset tile; see Unset.
 type Tile struct {
-	Char              byte
-	Color, Background int
-	Font              int
+	Rune              rune  // decoded character
+	Char              byte  // character in the original code page
+	Color, Background uint8 // palette index
+	Font              uint8
 	Attrib            uint32
+	Link              int32 // hyperlink number, see Buffer.Link
+	Combining         int32 // combining characters number, see Buffer.Combining
 }
 
 func NewTile() *Tile {
@@ -41,15 +49,28 @@ func NewTile() *Tile {
 	return t.Reset()
 }
 
+// Unset checks if nothing was written to the tile.
+func (t *Tile) Unset() bool {
+	return t.Rune == 0
+}
+
+// Blank checks if the tile is an empty space with the default background.
+func (t *Tile) Blank() bool {
+	return (t.Rune == ' ' || t.Rune == 0) && t.Combining == 0 &&
+		t.Background == TILE_DEFAULT_BACKGROUND && t.Attrib&^ATTRIB_BOLD == 0 && t.Link == 0
+}
+
 func (t *Tile) Equal(o *Tile) bool {
 	if o == nil {
 		return false
 	}
-	return t.Color == o.Color && t.Background == o.Background && t.Attrib == o.Attrib
+	return t.Color == o.Color && t.Background == o.Background && t.Attrib == o.Attrib && t.Link == o.Link
 }
 
 func (t *Tile) Reset() *Tile {
+	t.Rune = TILE_DEFAULT_CHAR
 	t.Char = TILE_DEFAULT_CHAR
+	t.Combining = 0
 	t.ResetAttrib()
 	return t
 }
@@ -63,14 +84,11 @@ func (t *Tile) ResetAttrib() *Tile {
 }
 
 func (t *Tile) String() string {
-	return fmt.Sprintf(`char=0x%02x, fg=%02d, bg=%02d, font=%d, attrib=%d`,
-		t.Char, t.Color, t.Background, t.Font, t.Attrib)
+	return fmt.Sprintf(`rune=%q, char=0x%02x, fg=%02d, bg=%02d, font=%d, attrib=%d, link=%d`,
+		t.Rune, t.Char, t.Color, t.Background, t.Font, t.Attrib, t.Link)
 }
 
 func (t *Tile) Update(o *Tile) *Tile {
-	t.Char = o.Char
-	t.Color, t.Background = o.Color, o.Background
-	t.Font = o.Font
-	t.Attrib = o.Attrib
+	*t = *o
 	return t
 }
@@ -0,0 +1,175 @@
+package buffer
+
+import (
+	"github.com/tehmaze-labs/go-piece/calc"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Glyph substitutions for mirrored and rotated buffers. The mirror tables
+// list pairs of glyphs that are each other's mirror image, the rotation table
+// lists glyphs that turn into the next glyph when rotated clockwise.
+var (
+	mirrorHorizontal = pairs("()[]{}<>/\\▌▐┌┐└┘├┤╔╗╚╝╠╣╒╕╓╖╘╛╙╜╞╡╟╢►◄→←≤≥«»⌐¬")
+	mirrorVertical   = pairs("▀▄┌└┐┘┬┴╔╚╗╝╦╩╒╘╕╛╓╙╖╜╤╧╥╨▲▼↑↓⌠⌡")
+	rotateClockwise  = cycles("▀▐▄▌", "┌┐┘└", "├┬┤┴", "╔╗╝╚", "╠╦╣╩", "╒╖╛╙",
+		"╓╕╜╘", "╞╥╡╨", "╟╤╢╧", "─│", "═║", "╪╫", "▲►▼◄", "↑→↓←")
+	rotateCounterClockwise = invert(rotateClockwise)
+)
+
+func pairs(s string) map[rune]rune {
+	r := []rune(s)
+	m := make(map[rune]rune, len(r))
+	for i := 0; i+1 < len(r); i += 2 {
+		m[r[i]], m[r[i+1]] = r[i+1], r[i]
+	}
+	return m
+}
+
+func cycles(ss ...string) map[rune]rune {
+	m := make(map[rune]rune)
+	for _, s := range ss {
+		r := []rune(s)
+		for i := range r {
+			m[r[i]] = r[(i+1)%len(r)]
+		}
+	}
+	return m
+}
+
+func invert(m map[rune]rune) map[rune]rune {
+	i := make(map[rune]rune, len(m))
+	for k, v := range m {
+		i[v] = k
+	}
+	return i
+}
+
+// substitute replaces the glyph of the tile. The original code page character
+// is replaced too, if the tile was drawn in code page 437.
+func substitute(t *Tile, glyphs map[rune]rune) {
+	r, ok := glyphs[t.Rune]
+	if !ok {
+		return
+	}
+	if charmap.CodePage437.DecodeByte(t.Char) == t.Rune {
+		if c, ok := charmap.CodePage437.EncodeRune(r); ok {
+			t.Char = c
+		}
+	}
+	t.Rune = r
+}
+
+// transform moves all tiles to a new w x h buffer, fn maps the position of
+// a tile to its new position. Rows are no longer marked as wrapped.
+func (b *Buffer) transform(w, h int, glyphs map[rune]rune, fn func(x, y int) (int, int)) {
+	var rows rowStore
+	rows.grow(h)
+	b.rows.each(func(y int, row []Tile) {
+		for x, t := range row {
+			if t.Unset() {
+				continue
+			}
+			substitute(&t, glyphs)
+			nx, ny := fn(x, y)
+			if nx >= 0 && nx < w && ny >= 0 && ny < h {
+				rows.touch(ny, w)[nx] = t
+			}
+		}
+	})
+
+	// Wide characters start with the first half
+	rows.each(func(_ int, row []Tile) {
+		for x := 0; x+1 < len(row); x++ {
+			if row[x].Rune == TILE_CONTINUATION && row[x+1].Rune != TILE_CONTINUATION {
+				row[x], row[x+1] = row[x+1], row[x]
+				x++
+			}
+		}
+	})
+
+	b.Cursor.X, b.Cursor.Y = fn(b.Cursor.X, b.Cursor.Y)
+	b.Cursor.X = calc.MaxInt(0, calc.MinInt(b.Cursor.X, w-1))
+	b.Cursor.Y = calc.MaxInt(0, b.Cursor.Y)
+	b.resized(w, calc.MinInt(b.Height, h), rows)
+}
+
+// FlipHorizontal mirrors the buffer along the vertical axis. Asymmetric
+// glyphs, such as half blocks and box drawing corners, are replaced by their
+// mirror image.
+func (b *Buffer) FlipHorizontal() *Buffer {
+	w := b.Width
+	b.transform(w, b.rows.n, mirrorHorizontal, func(x, y int) (int, int) {
+		return w - 1 - x, y
+	})
+	return b
+}
+
+// FlipVertical mirrors all rows of the buffer along the horizontal axis.
+// Asymmetric glyphs, such as half blocks and box drawing corners, are
+// replaced by their mirror image.
+func (b *Buffer) FlipVertical() *Buffer {
+	h := b.rows.n
+	b.transform(b.Width, h, mirrorVertical, func(x, y int) (int, int) {
+		return x, h - 1 - y
+	})
+	return b
+}
+
+// Rotate rotates the buffer by 90 degrees. Block elements and box drawing
+// glyphs are replaced by their rotated glyph, other characters are not
+// rotated. As character cells are about twice as high as they are wide,
+// rotation is best suited for box drawings and block art. An error is returned
+// if the rotated buffer exceeds the buffer limits.
+func (b *Buffer) Rotate(clockwise bool) (*Buffer, error) {
+	w, h := b.rows.n, b.Width
+	if err := b.checkSize(w, h); err != nil {
+		return b, err
+	}
+	if clockwise {
+		b.transform(w, h, rotateClockwise, func(x, y int) (int, int) {
+			return w - 1 - y, x
+		})
+	} else {
+		b.transform(w, h, rotateCounterClockwise, func(x, y int) (int, int) {
+			return y, h - 1 - x
+		})
+	}
+	return b, nil
+}
+
+// Crop reduces the buffer to the tiles in r, the tile at the top left corner
+// of r moves to column 0, row 0.
+func (b *Buffer) Crop(r Rect) *Buffer {
+	if r.Empty() {
+		return b
+	}
+	b.transform(r.Width, r.Height, nil, func(x, y int) (int, int) {
+		return x - r.X, y - r.Y
+	})
+	return b
+}
+
+// Trim crops the buffer to the smallest rectangle that contains all tiles
+// that are not blank, see Tile.Blank. An empty buffer is not changed.
+func (b *Buffer) Trim() *Buffer {
+	w, h := b.SizeMax()
+	r := Rect{X: w, Y: h}
+	var right, bottom int
+	for y := 0; y < h; y++ {
+		row := b.rows.row(y)
+		if row == nil {
+			continue
+		}
+		for x := 0; x < w && x < len(row); x++ {
+			if !row[x].Blank() {
+				r.X, r.Y = calc.MinInt(r.X, x), calc.MinInt(r.Y, y)
+				right, bottom = calc.MaxInt(right, x+1), y+1
+			}
+		}
+	}
+	if bottom == 0 {
+		return b
+	}
+	r.Width, r.Height = right-r.X, bottom-r.Y
+	return b.Crop(r)
+}
@@ -0,0 +1,45 @@
+package buffer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		op   func(b *Buffer)
+		want []string
+	}{
+		{"FlipHorizontal", []string{"▌ab(", "┌─.."}, func(b *Buffer) { b.FlipHorizontal() }, []string{")ba▐", "..─┐"}},
+		{"FlipVertical", []string{"▀┌", "x."}, func(b *Buffer) { b.FlipVertical() }, []string{"x.", "▄└"}},
+		{"Rotate clockwise", []string{"ab", "cd", "▀e"}, func(b *Buffer) { b.Rotate(true) }, []string{"▐ca", "edb"}},
+		{"Rotate counterclockwise", []string{"ab", "cd", "▀e"}, func(b *Buffer) { b.Rotate(false) }, []string{"bde", "ac▌"}},
+		{"Rotate box", []string{"┌─", "│."}, func(b *Buffer) { b.Rotate(true) }, []string{"─┐", ".│"}},
+		{"Crop", []string{"abcd", "efgh"}, func(b *Buffer) { b.Crop(Rect{1, 1, 2, 1}) }, []string{"fg"}},
+		{"Trim", []string{"....", ". x.", " .y."}, func(b *Buffer) { b.Trim() }, []string{"x", "y"}},
+		{"Trim blank", []string{"  ", "  "}, func(b *Buffer) { b.Trim() }, []string{"  ", "  "}},
+	}
+	for _, test := range tests {
+		b := draw(test.in...)
+		test.op(b)
+		if got := text(b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestTransformCodePage(t *testing.T) {
+	b := draw("▌x")
+	b.rows.row(0)[0].Char = 0xdd // ▌ in code page 437
+	b.rows.row(0)[1].Char = 'x'
+	b.FlipHorizontal()
+	row := b.Row(0)
+	if row[1].Rune != '▐' || row[1].Char != 0xde {
+		t.Errorf("expected ▐ (0xde), got %q (0x%02x)", row[1].Rune, row[1].Char)
+	}
+	if row[0].Char != 'x' {
+		t.Errorf("expected x, got 0x%02x", row[0].Char)
+	}
+}
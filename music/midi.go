@@ -0,0 +1,74 @@
+package music
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// MIDI output settings
+const (
+	MIDI_DIVISION = 480 // ticks per quarter note
+	MIDI_TEMPO    = 500000
+	MIDI_PROGRAM  = 80 // General MIDI square lead
+	MIDI_VELOCITY = 100
+	MIDI_OFFSET   = 23 // MIDI note number of note number 0
+)
+
+// WriteMIDI renders the tunes to w as a single track standard MIDI file.
+func WriteMIDI(w io.Writer, tunes ...*Tune) error {
+	var track bytes.Buffer
+	var delta time.Duration
+
+	// Tempo and program change
+	writeVarInt(&track, 0)
+	track.Write([]byte{0xff, 0x51, 0x03, MIDI_TEMPO >> 16, (MIDI_TEMPO >> 8) & 0xff, MIDI_TEMPO & 0xff})
+	writeVarInt(&track, 0)
+	track.Write([]byte{0xc0, MIDI_PROGRAM})
+
+	for _, t := range tunes {
+		for _, n := range t.Notes {
+			if n.Number == 0 {
+				delta += n.Duration + n.Rest
+				continue
+			}
+			k := byte(n.Number + MIDI_OFFSET)
+			writeVarInt(&track, midiTicks(delta))
+			track.Write([]byte{0x90, k, MIDI_VELOCITY})
+			writeVarInt(&track, midiTicks(n.Duration))
+			track.Write([]byte{0x80, k, 0})
+			delta = n.Rest
+		}
+	}
+
+	// End of track
+	writeVarInt(&track, midiTicks(delta))
+	track.Write([]byte{0xff, 0x2f, 0x00})
+
+	b := bufio.NewWriter(w)
+	b.WriteString("MThd")
+	binary.Write(b, binary.BigEndian, []uint32{6})
+	binary.Write(b, binary.BigEndian, []uint16{0, 1, MIDI_DIVISION})
+	b.WriteString("MTrk")
+	binary.Write(b, binary.BigEndian, uint32(track.Len()))
+	track.WriteTo(b)
+	return b.Flush()
+}
+
+// midiTicks converts a duration to ticks at the fixed MIDI tempo.
+func midiTicks(d time.Duration) uint32 {
+	return uint32(d * MIDI_DIVISION / (MIDI_TEMPO * time.Microsecond))
+}
+
+func writeVarInt(w *bytes.Buffer, v uint32) {
+	var b [5]byte
+	i := len(b) - 1
+	b[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		b[i] = byte(v&0x7f) | 0x80
+	}
+	w.Write(b[i:])
+}
@@ -0,0 +1,247 @@
+package music
+
+import (
+	"math"
+	"time"
+)
+
+// Defaults of the music macro language interpreter
+const (
+	MML_DEFAULT_TEMPO  = 120
+	MML_DEFAULT_LENGTH = 4
+	MML_DEFAULT_OCTAVE = 4
+)
+
+// Articulation styles
+const (
+	STYLE_NORMAL   = iota // note sounds 7/8 of its length
+	STYLE_LEGATO          // note sounds its full length
+	STYLE_STACCATO        // note sounds 3/4 of its length
+)
+
+// Note is a tone played on the PC speaker, or a rest if the Number is zero.
+type Note struct {
+	Number    int           // note number 1-84, O0 C is 1
+	Frequency float64       // frequency in Hz
+	Duration  time.Duration // time the tone sounds
+	Rest      time.Duration // silence following the tone
+}
+
+// Tune is a sequence of notes played by a single music sequence.
+type Tune struct {
+	Offset     int64 // byte offset of the sequence in the input
+	Background bool  // tune plays in the background
+	Notes      []Note
+}
+
+// Length returns the total playing time of the tune.
+func (t *Tune) Length() (d time.Duration) {
+	for _, n := range t.Notes {
+		d += n.Duration + n.Rest
+	}
+	return
+}
+
+// MML interprets strings in the music macro language, as used by the BASIC
+// PLAY statement and ANSI music. The tempo, length, octave and style carry
+// over from one string to the next.
+type MML struct {
+	Tempo  int // quarter notes per minute, 32-255
+	Length int // default note length, 1-64
+	Octave int // current octave, 0-6
+	Style  int // articulation style
+}
+
+// NewMML returns an interpreter with the default settings.
+func NewMML() *MML {
+	return &MML{
+		Tempo:  MML_DEFAULT_TEMPO,
+		Length: MML_DEFAULT_LENGTH,
+		Octave: MML_DEFAULT_OCTAVE,
+		Style:  STYLE_NORMAL,
+	}
+}
+
+var noteIndex = map[byte]int{
+	'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11,
+}
+
+// Parse interprets s and returns the resulting tune. Unknown commands and
+// out of range values are ignored.
+func (m *MML) Parse(s []byte) *Tune {
+	t := &Tune{}
+	r := &mmlReader{s: s}
+
+	for {
+		c, ok := r.next()
+		if !ok {
+			break
+		}
+		switch c = upper(c); c {
+		case 'T':
+			if n, ok := r.int(); ok && n >= 32 && n <= 255 {
+				m.Tempo = n
+			}
+		case 'L':
+			if n, ok := r.int(); ok && n >= 1 && n <= 64 {
+				m.Length = n
+			}
+		case 'O':
+			if n, ok := r.int(); ok && n >= 0 && n <= 6 {
+				m.Octave = n
+			}
+		case '<':
+			if m.Octave > 0 {
+				m.Octave--
+			}
+		case '>':
+			if m.Octave < 6 {
+				m.Octave++
+			}
+		case 'M':
+			if c, ok := r.next(); ok {
+				switch c = upper(c); c {
+				case 'F':
+					t.Background = false
+				case 'B':
+					t.Background = true
+				default:
+					m.setStyle(c)
+				}
+			}
+		case 'N':
+			if n, ok := r.int(); ok && n >= 0 && n <= 84 {
+				t.Notes = append(t.Notes, m.note(n, m.Length, r.dots()))
+			}
+		case 'P', 'R':
+			l, ok := r.int()
+			if !ok || l < 1 || l > 64 {
+				l = m.Length
+			}
+			t.Notes = append(t.Notes, m.note(0, l, r.dots()))
+		case 'A', 'B', 'C', 'D', 'E', 'F', 'G':
+			n := m.Octave*12 + noteIndex[c] + 1
+			if c, ok := r.peek(); ok {
+				switch c {
+				case '#', '+':
+					n++
+					r.next()
+				case '-':
+					n--
+					r.next()
+				}
+			}
+			l, ok := r.int()
+			if !ok || l < 1 || l > 64 {
+				l = m.Length
+			}
+			if n >= 1 && n <= 84 {
+				t.Notes = append(t.Notes, m.note(n, l, r.dots()))
+			}
+		}
+	}
+	return t
+}
+
+func (m *MML) setStyle(c byte) {
+	switch c {
+	case 'N':
+		m.Style = STYLE_NORMAL
+	case 'L':
+		m.Style = STYLE_LEGATO
+	case 'S':
+		m.Style = STYLE_STACCATO
+	}
+}
+
+// note returns note number n of length l, extended by the number of dots.
+func (m *MML) note(n, l, dots int) Note {
+	d := float64(time.Minute) / float64(m.Tempo) * 4 / float64(l)
+	for e := d / 2; dots > 0; dots-- {
+		d += e
+		e /= 2
+	}
+
+	on := d
+	if n > 0 {
+		switch m.Style {
+		case STYLE_NORMAL:
+			on = d * 7 / 8
+		case STYLE_STACCATO:
+			on = d * 3 / 4
+		}
+	}
+
+	note := Note{Number: n}
+	if n == 0 {
+		note.Rest = time.Duration(d)
+	} else {
+		note.Frequency = Frequency(n)
+		note.Duration = time.Duration(on)
+		note.Rest = time.Duration(d - on)
+	}
+	return note
+}
+
+// Frequency returns the frequency of note number n, where O3 A (note 46) is
+// 440 Hz.
+func Frequency(n int) float64 {
+	return 440 * math.Pow(2, float64(n-46)/12)
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+type mmlReader struct {
+	s []byte
+	o int
+}
+
+// skip skips over white space.
+func (r *mmlReader) skip() {
+	for r.o < len(r.s) && (r.s[r.o] == ' ' || r.s[r.o] == '\t') {
+		r.o++
+	}
+}
+
+func (r *mmlReader) peek() (byte, bool) {
+	r.skip()
+	if r.o < len(r.s) {
+		return r.s[r.o], true
+	}
+	return 0, false
+}
+
+func (r *mmlReader) next() (byte, bool) {
+	c, ok := r.peek()
+	if ok {
+		r.o++
+	}
+	return c, ok
+}
+
+func (r *mmlReader) int() (n int, ok bool) {
+	r.skip()
+	for r.o < len(r.s) && r.s[r.o] >= '0' && r.s[r.o] <= '9' {
+		if n < 1<<20 {
+			n = n*10 + int(r.s[r.o]-'0')
+		}
+		r.o++
+		ok = true
+	}
+	return
+}
+
+func (r *mmlReader) dots() (n int) {
+	for {
+		if c, ok := r.peek(); !ok || c != '.' {
+			return
+		}
+		r.next()
+		n++
+	}
+}
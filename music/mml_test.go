@@ -0,0 +1,87 @@
+package music
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMMLParse(t *testing.T) {
+	const ms = time.Millisecond
+	type note struct {
+		number   int
+		duration time.Duration // tone
+		length   time.Duration // tone and rest
+	}
+	tests := []struct {
+		in    string
+		notes []note
+	}{
+		{"C", []note{{49, 437500 * time.Microsecond, 500 * ms}}},
+		{"c d e", []note{{49, 437500 * time.Microsecond, 500 * ms}, {51, 437500 * time.Microsecond, 500 * ms}, {53, 437500 * time.Microsecond, 500 * ms}}},
+		{"O3A", []note{{46, 437500 * time.Microsecond, 500 * ms}}},
+		{"C#D+E-", []note{{50, 437500 * time.Microsecond, 500 * ms}, {52, 437500 * time.Microsecond, 500 * ms}, {52, 437500 * time.Microsecond, 500 * ms}}},
+		{"O0C-", nil},
+		{"L8C", []note{{49, 218750 * time.Microsecond, 250 * ms}}},
+		{"C8", []note{{49, 218750 * time.Microsecond, 250 * ms}}},
+		{"C4.", []note{{49, 656250 * time.Microsecond, 750 * ms}}},
+		{"C4..", []note{{49, 765625 * time.Microsecond, 875 * ms}}},
+		{"T240C", []note{{49, 218750 * time.Microsecond, 250 * ms}}},
+		{"T10C", []note{{49, 437500 * time.Microsecond, 500 * ms}}},
+		{"MLC", []note{{49, 500 * ms, 500 * ms}}},
+		{"MSC", []note{{49, 375 * ms, 500 * ms}}},
+		{"P4R8", []note{{0, 0, 500 * ms}, {0, 0, 250 * ms}}},
+		{"N0N49", []note{{0, 0, 500 * ms}, {49, 437500 * time.Microsecond, 500 * ms}}},
+		{"N85", nil},
+		{"O6>C", []note{{73, 437500 * time.Microsecond, 500 * ms}}},
+		{"O0<C", []note{{1, 437500 * time.Microsecond, 500 * ms}}},
+		{"XYZ C", []note{{49, 437500 * time.Microsecond, 500 * ms}}},
+	}
+	for _, test := range tests {
+		tune := NewMML().Parse([]byte(test.in))
+		if len(tune.Notes) != len(test.notes) {
+			t.Errorf("%q: expected %d notes, got %d", test.in, len(test.notes), len(tune.Notes))
+			continue
+		}
+		for i, n := range tune.Notes {
+			want := test.notes[i]
+			if n.Number != want.number || n.Duration != want.duration || n.Duration+n.Rest != want.length {
+				t.Errorf("%q: note %d: expected %+v, got %+v", test.in, i, want, n)
+			}
+		}
+	}
+}
+
+func TestMMLState(t *testing.T) {
+	m := NewMML()
+	if tune := m.Parse([]byte("MB O2 L8 T60")); !tune.Background || len(tune.Notes) != 0 {
+		t.Errorf("expected a background tune without notes, got %+v", tune)
+	}
+	tune := m.Parse([]byte("C"))
+	if tune.Background {
+		t.Error("background carried over to the next tune")
+	}
+	if len(tune.Notes) != 1 || tune.Notes[0].Number != 25 {
+		t.Fatalf("expected note 25, got %+v", tune.Notes)
+	}
+	if l := tune.Length(); l != 500*time.Millisecond {
+		t.Errorf("expected length 500ms, got %s", l)
+	}
+}
+
+func TestFrequency(t *testing.T) {
+	tests := []struct {
+		n    int
+		freq float64
+	}{
+		{46, 440},
+		{34, 220},
+		{58, 880},
+		{49, 523.251},
+	}
+	for _, test := range tests {
+		if f := Frequency(test.n); math.Abs(f-test.freq) > 0.001 {
+			t.Errorf("note %d: expected %.3f Hz, got %.3f Hz", test.n, test.freq, f)
+		}
+	}
+}
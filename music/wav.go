@@ -0,0 +1,73 @@
+package music
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// WAV output settings
+const (
+	WAV_DEFAULT_RATE = 22050
+	WAV_AMPLITUDE    = 48
+	WAV_SILENCE      = 0x80
+)
+
+// WriteWAV renders the tunes to w as an 8-bit mono WAV file at the given
+// sample rate, using a square wave like the PC speaker.
+func WriteWAV(w io.Writer, rate int, tunes ...*Tune) error {
+	var samples int
+	for _, t := range tunes {
+		for _, n := range t.Notes {
+			samples += wavSamples(n.Duration, rate) + wavSamples(n.Rest, rate)
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(36 + samples),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),   // format chunk size
+		uint16(1),    // PCM
+		uint16(1),    // channels
+		uint32(rate), // sample rate
+		uint32(rate), // byte rate
+		uint16(1),    // block align
+		uint16(8),    // bits per sample
+		[4]byte{'d', 'a', 't', 'a'},
+		uint32(samples),
+	}
+	for _, v := range header {
+		if err := binary.Write(b, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range tunes {
+		for _, n := range t.Notes {
+			var phase float64
+			step := n.Frequency / float64(rate)
+			for i := wavSamples(n.Duration, rate); i > 0; i-- {
+				s := byte(WAV_SILENCE + WAV_AMPLITUDE)
+				if phase >= 0.5 {
+					s = WAV_SILENCE - WAV_AMPLITUDE
+				}
+				b.WriteByte(s)
+				if phase += step; phase >= 1 {
+					phase -= 1
+				}
+			}
+			for i := wavSamples(n.Rest, rate); i > 0; i-- {
+				b.WriteByte(WAV_SILENCE)
+			}
+		}
+	}
+	return b.Flush()
+}
+
+func wavSamples(d time.Duration, rate int) int {
+	return int(d * time.Duration(rate) / time.Second)
+}
@@ -1,21 +1,40 @@
 package parser
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"html"
 	"io"
-	"log"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/tehmaze-labs/go-piece/buffer"
 	"github.com/tehmaze-labs/go-piece/calc"
 	"github.com/tehmaze-labs/go-piece/color"
-	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/transform"
+	"github.com/tehmaze-labs/go-piece/music"
 )
 
 const (
-	ANSI_TABSTOP = 8
+	ANSI_TABSTOP   = 8
+	ANSI_READ_SIZE = 4096
+	ANSI_MUSIC_MAX = 4096  // maximum length of a music string
+	ANSI_PARAM_MAX = 65535 // larger numeric parameters are clamped
+)
+
+// Device Status Report requests
+const (
+	ANSI_DSR_STATUS = 5 // Report operating status
+	ANSI_DSR_CPR    = 6 // Report cursor position
+)
+
+// Replies to device queries
+const (
+	ANSI_REPLY_DA        = "\x1b[?1;0c" // VT100 with no options
+	ANSI_REPLY_STATUS_OK = "\x1b[0n"
+	ANSI_REPLY_CPR       = "\x1b[%d;%dR"
 )
 
 // ECMA-48 specified Final Bytes of control sequences without intermediate bytes
@@ -70,123 +89,370 @@ const (
 	ANSI_DAQ                     // 'o', Define Area Qualification
 )
 
-type ansiOp func(seq *ANSISequence) error
+// Private (DEC) Final Bytes of control sequences
+const (
+	ANSI_DECSTBM = 'r' // Set Top and Bottom Margins
+)
+
+// Final Byte of the CTerm ANSI music sequence, BananaCom ANSI music uses
+// ANSI_DL and ANSI_EF
+const (
+	ANSI_MUSIC = '|'
+)
+
+// Opcode identifies a control sequence by its private parameter prefix,
+// intermediate bytes and final byte.
+type Opcode struct {
+	Private      byte
+	Intermediate string
+	Final        byte
+}
+
+// OpcodeHandler handles a control sequence. The parser gives access to the
+// buffer, cursor and current token, the sequence holds the parameters.
+type OpcodeHandler func(p *ANSI, seq *ANSISequence) error
 
 type ANSI struct {
-	Palette   color.Palette
-	buffer    *buffer.Buffer
-	opcode    map[byte]ansiOp
-	transform transform.Transformer
+	Palette color.Palette
+
+	// Reply receives the responses to device status and attribute queries,
+	// if set. Writes happen while parsing, so Reply must not write back to
+	// the parser from the same goroutine.
+	Reply io.Writer
+
+	// Diagnostics receives problems encountered in the input, if set.
+	Diagnostics DiagnosticSink
+
+	// APC receives the application program command strings that are not
+	// handled by CTerm, if set.
+	APC func(p *ANSI, s []byte) error
+
+	// CTerm is the state of the CTerm (SyncTERM) extensions.
+	CTerm CTerm
+
+	// Music are the ANSI music sequences found in the input.
+	Music []*music.Tune
+
+	// Title is the last window title set with an OSC sequence.
+	Title string
+
+	buffer   *buffer.Buffer
+	opcode   map[Opcode]OpcodeHandler
+	codepage CodePage
+	decode   [256]rune
+	utf8     bool
+	partial  []byte // incomplete UTF-8 sequence
+	lexer    *Lexer
+	seq      *ANSISequence
+	tok      *Token
+	limits   Limits
+	profile  Profile
+	font     int
+	mml      *music.MML
+	data     func(b []byte) error
+	err      error
+	mu       sync.Mutex
 }
 
 func NewANSI(w, h int) *ANSI {
 	p := &ANSI{
-		Palette:   color.VGAPalette,
-		buffer:    buffer.New(w, h),
-		transform: charmap.CodePage437.NewDecoder(),
+		Palette: color.VGAPalette,
+		buffer:  buffer.New(w, h),
+		seq:     NewANSISequence(),
+		mml:     music.NewMML(),
 	}
-	p.opcode = map[byte]ansiOp{
-		ANSI_CHA: p.parseCHA,
-		ANSI_CNL: p.parseCNL,
-		ANSI_CPL: p.parseCHA,
-		ANSI_CUB: p.parseCUB,
-		ANSI_CUD: p.parseCUD,
-		ANSI_CUF: p.parseCUF,
-		ANSI_CUP: p.parseCUP,
-		ANSI_CUU: p.parseCUU,
-		ANSI_ED:  p.parseED,
-		ANSI_EL:  p.parseEL,
-		ANSI_IL:  p.parseIL,
-		ANSI_HVP: p.parseCUP, // alias
-		ANSI_SGR: p.parseSGR,
+	p.SetCodePage(DefaultCodePage)
+	p.lexer = NewLexer(p.token)
+	p.SetProfile(DefaultProfile)
+	p.opcode = make(map[Opcode]OpcodeHandler, len(ansiOpcodes))
+	for op, fn := range ansiOpcodes {
+		p.opcode[op] = fn
 	}
 	return p
 }
 
-func (p *ANSI) Parse(r io.Reader) (err error) {
-	state := STATE_TEXT
+// Handle registers the handler for an opcode, replacing the existing handler.
+// A nil handler removes support for the opcode.
+func (p *ANSI) Handle(op Opcode, fn OpcodeHandler) {
+	if fn == nil {
+		delete(p.opcode, op)
+	} else {
+		p.opcode[op] = fn
+	}
+}
+
+// Handler returns the handler for an opcode, or nil if the opcode is not
+// supported.
+func (p *ANSI) Handler(op Opcode) OpcodeHandler {
+	return p.opcode[op]
+}
+
+// ReadData passes the next n bytes of input to fn, without interpreting them.
+// It can be used by an OpcodeHandler for sequences that are followed by binary
+// data.
+func (p *ANSI) ReadData(n int, fn func(b []byte) error) {
+	p.data = fn
+	p.lexer.Data(n)
+}
+
+// ReadUntil is like ReadData, but the data ends with the delimiter, which is
+// included in b. At most max bytes are read if no delimiter is found.
+func (p *ANSI) ReadUntil(delim byte, max int, fn func(b []byte) error) {
+	p.data = fn
+	p.lexer.DataUntil(delim, max)
+}
+
+// putChar decodes c and writes it to the buffer.
+func (p *ANSI) putChar(c byte) error {
+	return p.buffer.PutRune(p.decode[c], c)
+}
+
+// Token returns the token that is being processed. It is only valid inside an
+// OpcodeHandler.
+func (p *ANSI) Token() *Token {
+	return p.tok
+}
+
+// Limits restricts the resources used by the parser. A zero value means there
+// is no limit.
+type Limits struct {
+	buffer.Limits
+	MaxInput    int64 // maximum number of input bytes
+	MaxSequence int   // maximum length of a control sequence
+	MaxString   int   // maximum length of an OSC or APC control string
+}
+
+// DefaultLimits are sensible limits for parsing untrusted input.
+var DefaultLimits = Limits{
+	Limits: buffer.Limits{
+		MaxWidth:  1024,
+		MaxHeight: 65536,
+		MaxTiles:  1 << 24,
+	},
+	MaxInput:    64 << 20,
+	MaxSequence: 256,
+	MaxString:   64 << 10,
+}
+
+// SetLimits sets the resource limits for the parser and its buffer.
+func (p *ANSI) SetLimits(l Limits) {
+	p.limits = l
+	p.buffer.Limits = l.Limits
+	p.lexer.MaxSequence = l.MaxSequence
+	p.lexer.MaxString = l.MaxString
+}
+
+// Buffer returns the buffer the parser draws on.
+func (p *ANSI) Buffer() *buffer.Buffer {
+	return p.buffer
+}
+
+// Parse reads from r until EOF or SUB and draws on the buffer. Input is read
+// in chunks of ANSI_READ_SIZE bytes. The parser state is kept between calls,
+// so input may be split over multiple readers.
+func (p *ANSI) Parse(r io.Reader) error {
+	return p.ParseContext(context.Background(), r)
+}
 
-	var seq = NewANSISequence()
-	var buf = make([]byte, 1)
+// ParseContext is like Parse, but stops with ctx.Err() when the context is
+// cancelled. The context is checked before every chunk that is read.
+func (p *ANSI) ParseContext(ctx context.Context, r io.Reader) (err error) {
+	var buf = make([]byte, ANSI_READ_SIZE)
 	var n int
-	for state != STATE_EXIT {
-		if n, err = r.Read(buf); n != 1 || err != nil {
-			state = STATE_EXIT
-			continue
+	for !p.lexer.Done() {
+		if err = ctx.Err(); err != nil {
+			return err
 		}
-
-		ch := buf[0]
-
-		switch state {
-		case STATE_TEXT:
-			switch ch {
-			case SUB: // End Of File
-				state = STATE_EXIT
-			case ESC:
-				state = STATE_ANSI_WAIT_BRACE
-			case NL:
-				p.buffer.Cursor.Y++
-			case CR:
-				p.buffer.Cursor.X = 0
-			case TAB:
-				c := (p.buffer.Cursor.X + 1) % ANSI_TABSTOP
-				if c > 0 {
-					c = ANSI_TABSTOP - c
-					for i := 0; i < c; i++ {
-						p.buffer.PutChar(' ')
-					}
-				}
-			default:
-				p.buffer.PutChar(ch)
+		n, err = r.Read(buf)
+		if n > 0 {
+			if _, werr := p.Write(buf[:n]); werr != nil {
+				return werr
 			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		case STATE_ANSI_WAIT_BRACE:
-			if ch == '[' {
-				state = STATE_ANSI_WAIT_LITERAL
-			} else {
-				p.buffer.PutChar(ESC)
-				p.buffer.PutChar(ch)
-			}
+// Write implements io.Writer, it draws the contents of b on the buffer. The
+// parser state is kept between writes, so sequences may be split over multiple
+// writes. Input following a SUB is discarded. If one of the limits is exceeded,
+// a *buffer.LimitError is returned and all further input is discarded.
+func (p *ANSI) Write(b []byte) (n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return 0, p.err
+	}
 
-		case STATE_ANSI_WAIT_LITERAL:
-			if ch == ';' {
-				seq.Flush()
-				break
+	if max := p.limits.MaxInput; max > 0 && p.lexer.Offset()+int64(len(b)) > max {
+		o := p.lexer.Offset()
+		if n, err = p.lexer.Write(b[:max-o]); err == nil {
+			err = &buffer.LimitError{Limit: "input", Value: o + int64(len(b)), Max: max}
+		}
+	} else {
+		n, err = p.lexer.Write(b)
+	}
+	if err != nil {
+		p.err = err
+	}
+	return
+}
+
+// Snapshot returns a copy of the buffer, it is safe to call while another
+// goroutine is writing to the parser.
+func (p *ANSI) Snapshot() *buffer.Buffer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.buffer.Copy()
+}
+
+// Reset clears the buffer and returns the parser to its initial state.
+func (p *ANSI) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, h := p.buffer.Width, p.buffer.Height
+	m := p.buffer.Mode()
+	p.buffer = buffer.New(w, h)
+	p.buffer.SetMode(m)
+	p.buffer.Limits = p.limits.Limits
+	p.buffer.AutoWrap = p.profile.AutoWrap
+	p.buffer.DeferWrap = p.profile.DeferWrap
+	p.CTerm = CTerm{}
+	p.Music = nil
+	p.Title = ""
+	p.mml = music.NewMML()
+	p.font = 0
+	p.data = nil
+	p.partial = nil
+	p.err = nil
+	p.lexer.Reset()
+}
+
+// Lexer returns the lexer that feeds the parser.
+func (p *ANSI) Lexer() *Lexer {
+	return p.lexer
+}
+
+// token applies a token from the lexer to the buffer. If the buffer records
+// its changes, each token is recorded as a group, see buffer.Buffer.Record.
+func (p *ANSI) token(t *Token) (err error) {
+	p.tok = t
+	p.buffer.Group()
+	if len(p.partial) > 0 && t.Type != TOKEN_TEXT {
+		// Interrupted UTF-8 sequence
+		p.partial = p.partial[:0]
+		if err = p.putRune(utf8.RuneError); err != nil {
+			return
+		}
+	}
+	switch t.Type {
+	case TOKEN_TEXT:
+		if p.utf8 {
+			return p.putUTF8(t.Raw)
+		}
+		for _, ch := range t.Raw {
+			if err = p.putChar(ch); err != nil {
+				return
 			}
+		}
 
-			if isAlpha(ch) {
-				seq.Flush()
-				//log.Printf("ANSI sequence <ESC>[%s%c (0x%02x)\n", seq, ch, ch)
-
-				fn := p.opcode[ch]
-				if fn == nil {
-					log.Printf("Unsupported ANSI sequence <ESC>[%s%c (0x%02x)\n", seq, ch, ch)
-				} else {
-					if err = fn(seq); err != nil {
-						log.Printf("Parser error: %v\n", err)
-					}
+	case TOKEN_CONTROL:
+		switch t.Final {
+		case NL:
+			p.buffer.LineFeed()
+			if p.profile.NewLine {
+				p.buffer.CarriageReturn()
+			}
+		case CR:
+			p.buffer.CarriageReturn()
+		case TAB:
+			c := (p.buffer.Cursor.X + 1) % ANSI_TABSTOP
+			if c > 0 {
+				c = ANSI_TABSTOP - c
+				for i := 0; i < c && err == nil; i++ {
+					err = p.putChar(' ')
 				}
+			}
+		default:
+			err = p.putChar(t.Final)
+		}
 
-				seq.Reset()
-				state = STATE_TEXT
-				break
-			} // if isAlpha(ch)
-			seq.Buffer(ch)
+	case TOKEN_CSI:
+		fn := p.opcode[Opcode{t.Private, string(t.Intermediate), t.Final}]
+		if fn == nil {
+			p.Diagnose(DIAG_UNSUPPORTED, "")
+			break
+		}
+		p.seq.Load(t.Param)
+		if err = fn(p, p.seq); err != nil {
+			p.Diagnose(DIAG_ERROR, "%v", err)
+			if _, ok := err.(*buffer.LimitError); !ok {
+				err = nil
+			}
+		}
 
-		default:
+	case TOKEN_ESC:
+		if len(t.Intermediate) > 0 {
+			p.Diagnose(DIAG_UNSUPPORTED, "")
 			break
 		}
-	}
+		// Not a control sequence, draw the escape as a character
+		if err = p.putChar(ESC); err == nil {
+			err = p.putChar(t.Final)
+		}
 
-	w, h := p.buffer.SizeMax()
-	log.Printf("screen at %d x %d\n", w+1, h+1)
+	case TOKEN_APC:
+		if bytes.HasPrefix(t.Param, []byte(CTERM_APC)) {
+			err = p.parseCTermAPC(t.Param)
+		} else if p.APC == nil {
+			p.Diagnose(DIAG_UNSUPPORTED, "")
+		} else if err = p.APC(p, t.Param); err != nil {
+			p.Diagnose(DIAG_ERROR, "%v", err)
+			err = nil
+		}
 
-	return nil
+	case TOKEN_DATA:
+		if fn := p.data; fn != nil {
+			p.data = nil
+			if err = fn(t.Raw); err != nil {
+				p.Diagnose(DIAG_ERROR, "%v", err)
+				err = nil
+			}
+		}
+
+	case TOKEN_OSC:
+		err = p.parseOSC(t.Param)
+
+	case TOKEN_INVALID:
+		p.Diagnose(DIAG_UNSUPPORTED, "")
+	}
+	return
+}
+
+// Diagnose sends a diagnostic for the current token to the sink.
+func (p *ANSI) Diagnose(kind int, format string, v ...interface{}) {
+	if p.Diagnostics == nil {
+		return
+	}
+	x, y := p.buffer.Cursor.Pos()
+	p.Diagnostics.Diagnostic(&Diagnostic{
+		Kind:    kind,
+		Offset:  p.tok.Offset,
+		X:       x,
+		Y:       y,
+		Raw:     append([]byte(nil), p.tok.Raw...),
+		Message: fmt.Sprintf(format, v...),
+	})
 }
 
 func (p *ANSI) Html() (s string) {
 	s += "<!doctype html>\n"
-	s += "<link rel=\"stylesheet\" href=\"cp437.css\">\n"
+	s += fmt.Sprintf("<link rel=\"stylesheet\" href=\"%s\">\n", p.codepage.Stylesheet())
 	s += "<style type=\"text/css\">\n"
 	for i := 0; i < len(p.Palette); i++ {
 		c := p.Palette[i].Hex()
@@ -204,66 +470,80 @@ func (p *ANSI) Html() (s string) {
 
 	w, h := p.buffer.SizeMax()
 	var l *buffer.Tile
+	var link int32
 
-	for o, t := range p.buffer.Tiles {
-		y, x := calc.DivMod(o, p.buffer.Width)
-		if x >= w {
-			continue
-		}
-		if y >= h {
-			break
-		}
-		if x == 0 && y > 0 {
-			s += "\n"
-		}
-		if t == nil {
-			s += " "
-		} else if t.Equal(l) {
-			//s += string(t.Char)
-			if isPrint(t.Char) {
-				s += string(t.Char)
-			} else {
-				s += fmt.Sprintf(`&#x%02x;`, t.Char)
-			}
-		} else {
-			f := t.Color
-			b := t.Background
-			c := []string{}
-
-			if t.Attrib&buffer.ATTRIB_BOLD == buffer.ATTRIB_BOLD {
-				f += 8
-			}
-			if t.Attrib&buffer.ATTRIB_BLINK == buffer.ATTRIB_BLINK {
-				b += 8
-			}
-			if t.Attrib&buffer.ATTRIB_NEGATIVE == buffer.ATTRIB_NEGATIVE {
-				f, b = b, f
+	for y := 0; y < h; y++ {
+		row := p.buffer.Row(y)
+		for x := 0; x < w; x++ {
+			var t *buffer.Tile
+			if row != nil && !row[x].Unset() {
+				t = &row[x]
 			}
-			c = append(c, fmt.Sprintf("b%02x", b))
-			c = append(c, fmt.Sprintf("f%02x", f))
-			if t.Attrib&buffer.ATTRIB_ITALICS > 0 {
-				c = append(c, "i")
+			if x == 0 && y > 0 {
+				s += "\n"
 			}
-			if t.Attrib&buffer.ATTRIB_UNDERLINE > 0 {
-				c = append(c, fmt.Sprintf("u%02x", f))
+
+			var tl int32
+			if t != nil && isSafeLink(p.buffer.Link(t.Link)) {
+				tl = t.Link
 			}
-			if t.Attrib&buffer.ATTRIB_UNDERLINE_DOUBLE > 0 {
-				c = append(c, "ud")
+			if tl != link {
+				s += `</span>`
+				if link != 0 {
+					s += `</a>`
+				}
+				if tl != 0 {
+					s += fmt.Sprintf(`<a href="%s">`, html.EscapeString(p.buffer.Link(tl)))
+				}
+				s += fmt.Sprintf(`<span class="b%02x f%02x">`,
+					buffer.TILE_DEFAULT_BACKGROUND,
+					buffer.TILE_DEFAULT_COLOR)
+				link, l = tl, nil
 			}
 
-			s += `</span>`
-			s += fmt.Sprintf(`<span class="%s">`, strings.Join(c, " "))
-			if isPrint(t.Char) {
-				s += string(t.Char)
+			if t == nil {
+				s += " "
+			} else if t.Equal(l) {
+				s += html.EscapeString(p.buffer.Text(t))
 			} else {
-				s += fmt.Sprintf(`&#x%02x;`, t.Char)
+				f := t.Color
+				b := t.Background
+				c := []string{}
+
+				if t.Attrib&buffer.ATTRIB_BOLD == buffer.ATTRIB_BOLD {
+					f += 8
+				}
+				if t.Attrib&buffer.ATTRIB_BLINK == buffer.ATTRIB_BLINK {
+					b += 8
+				}
+				if t.Attrib&buffer.ATTRIB_NEGATIVE == buffer.ATTRIB_NEGATIVE {
+					f, b = b, f
+				}
+				c = append(c, fmt.Sprintf("b%02x", b))
+				c = append(c, fmt.Sprintf("f%02x", f))
+				if t.Attrib&buffer.ATTRIB_ITALICS > 0 {
+					c = append(c, "i")
+				}
+				if t.Attrib&buffer.ATTRIB_UNDERLINE > 0 {
+					c = append(c, fmt.Sprintf("u%02x", f))
+				}
+				if t.Attrib&buffer.ATTRIB_UNDERLINE_DOUBLE > 0 {
+					c = append(c, "ud")
+				}
+
+				s += `</span>`
+				s += fmt.Sprintf(`<span class="%s">`, strings.Join(c, " "))
+				s += html.EscapeString(p.buffer.Text(t))
 			}
-		}
 
-		l = t
+			l = t
+		}
 	}
 
 	s += `</span>`
+	if link != 0 {
+		s += `</a>`
+	}
 	s += `</pre>`
 	return
 }
@@ -271,13 +551,12 @@ func (p *ANSI) Html() (s string) {
 func (p *ANSI) String() (s string) {
 	w, h := p.buffer.SizeMax()
 	for y := 0; y < h; y++ {
+		row := p.buffer.Row(y)
 		for x := 0; x < w; x++ {
-			o := (y * p.buffer.Width) + x
-			t := p.buffer.Tile(o)
-			if t == nil {
+			if row == nil || row[x].Unset() {
 				s += " "
 			} else {
-				s += string(t.Char)
+				s += p.buffer.Text(&row[x])
 			}
 		}
 		s += "\n"
@@ -306,23 +585,51 @@ func (s *ANSISequence) Flush() {
 	s.b = make([]byte, 0)
 }
 
+// Int returns parameter n as a number, clamped to ANSI_PARAM_MAX. Missing
+// and malformed parameters are zero.
 func (s *ANSISequence) Int(n int) (i int) {
 	if n < s.Len() {
-		i, _ = strconv.Atoi(s.s[n])
+		i, _ = atoi(s.s[n])
 	}
 	return
 }
 
+// Ints returns the numeric parameters, clamped to ANSI_PARAM_MAX. Malformed
+// parameters are skipped.
 func (s *ANSISequence) Ints() (i []int) {
 	i = make([]int, 0)
 	for _, j := range s.s {
-		if n, err := strconv.Atoi(j); err == nil {
+		if n, err := atoi(j); err == nil {
 			i = append(i, n)
 		}
 	}
 	return
 }
 
+// atoi parses a parameter, numbers that are too large are clamped to
+// ANSI_PARAM_MAX.
+func atoi(s string) (int, error) {
+	i, err := strconv.Atoi(s)
+	if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
+		i, err = ANSI_PARAM_MAX, nil
+	}
+	return calc.MinInt(i, ANSI_PARAM_MAX), err
+}
+
+// Load replaces the parameters with the ';' separated parameters in b.
+func (s *ANSISequence) Load(b []byte) {
+	s.s = s.s[:0]
+	s.b = s.b[:0]
+	for _, c := range b {
+		if c == ';' {
+			s.Flush()
+		} else {
+			s.Buffer(c)
+		}
+	}
+	s.Flush()
+}
+
 func (s *ANSISequence) Len() int {
 	return len(s.s)
 }
@@ -1,49 +1,81 @@
 package parser
 
 import (
-	"log"
+	"fmt"
+	"io"
 
 	"github.com/tehmaze-labs/go-piece/buffer"
-	"github.com/tehmaze-labs/go-piece/calc"
 )
 
+// ansiOpcodes are the default handlers for control sequences.
+var ansiOpcodes = map[Opcode]OpcodeHandler{
+	{Final: ANSI_CHA}:     (*ANSI).parseCHA,
+	{Final: ANSI_CNL}:     (*ANSI).parseCNL,
+	{Final: ANSI_CPL}:     (*ANSI).parseCPL,
+	{Final: ANSI_CUB}:     (*ANSI).parseCUB,
+	{Final: ANSI_CUD}:     (*ANSI).parseCUD,
+	{Final: ANSI_CUF}:     (*ANSI).parseCUF,
+	{Final: ANSI_CUP}:     (*ANSI).parseCUP,
+	{Final: ANSI_CUU}:     (*ANSI).parseCUU,
+	{Final: ANSI_DA}:      (*ANSI).parseDA,
+	{Final: ANSI_DSR}:     (*ANSI).parseDSR,
+	{Final: ANSI_ED}:      (*ANSI).parseED,
+	{Final: ANSI_EL}:      (*ANSI).parseEL,
+	{Final: ANSI_IL}:      (*ANSI).parseIL,
+	{Final: ANSI_HVP}:     (*ANSI).parseCUP, // alias
+	{Final: ANSI_SD}:      (*ANSI).parseSD,
+	{Final: ANSI_SGR}:     (*ANSI).parseSGR,
+	{Final: ANSI_SU}:      (*ANSI).parseSU,
+	{Final: ANSI_DECSTBM}: (*ANSI).parseDECSTBM,
+	{Final: ANSI_DL}:      (*ANSI).parseMusic,
+	{Final: ANSI_EF}:      (*ANSI).parseMusic,
+	{Final: ANSI_MUSIC}:   (*ANSI).parseMusic,
+
+	// CTerm (SyncTERM) extensions
+	{Intermediate: " ", Final: ANSI_CUB}: (*ANSI).parseCTermFont,
+	{Private: '=', Final: '{'}:           (*ANSI).parseCTermFontLoad,
+	{Private: '?', Final: ANSI_SM}:       (*ANSI).parseCTermSM,
+	{Private: '?', Final: ANSI_RM}:       (*ANSI).parseCTermRM,
+	{Private: '=', Final: ANSI_SM}:       (*ANSI).parseCTermSM,
+	{Private: '=', Final: ANSI_RM}:       (*ANSI).parseCTermRM,
+}
+
 // Cursor Character Absolute
 func (p *ANSI) parseCHA(s *ANSISequence) (err error) {
 	x := 0
 	if s.Len() > 0 {
 		x = s.Int(0) - 1
 	}
-	p.buffer.Cursor.X = calc.MaxInt(0, x)
+	p.checkRange(x, p.buffer.Cursor.Y)
+	p.buffer.Column(x)
 	return
 }
 
 // Cursor Next Line
 func (p *ANSI) parseCNL(s *ANSISequence) (err error) {
 	y := 1
-	if s.Len() > 0 {
-		y = s.Int(0)
+	if v := s.Int(0); v > 0 {
+		y = v
 	}
-	p.buffer.Cursor.X = 0
-	p.buffer.Cursor.Down(y)
+	p.buffer.CarriageReturn().Down(y)
 	return
 }
 
 // Cursor Preceding Line
 func (p *ANSI) parseCPL(s *ANSISequence) (err error) {
 	y := 1
-	if s.Len() > 0 {
-		y = s.Int(0)
+	if v := s.Int(0); v > 0 {
+		y = v
 	}
-	p.buffer.Cursor.X = 0
-	p.buffer.Cursor.Up(y)
+	p.buffer.CarriageReturn().Up(y)
 	return
 }
 
 // Cursor Left
 func (p *ANSI) parseCUB(s *ANSISequence) (err error) {
 	x := 1
-	if s.Len() > 0 {
-		x = s.Int(0)
+	if v := s.Int(0); v > 0 {
+		x = v
 	}
 	p.buffer.Cursor.Left(x)
 	return
@@ -52,20 +84,21 @@ func (p *ANSI) parseCUB(s *ANSISequence) (err error) {
 // Cursor Down
 func (p *ANSI) parseCUD(s *ANSISequence) (err error) {
 	y := 1
-	if s.Len() > 0 {
-		y = s.Int(0)
+	if v := s.Int(0); v > 0 {
+		y = v
 	}
-	p.buffer.Cursor.Down(y)
+	p.buffer.Down(y)
 	return
 }
 
 // Cursor Right
 func (p *ANSI) parseCUF(s *ANSISequence) (err error) {
 	x := 1
-	if s.Len() > 0 {
-		x = s.Int(0)
+	if v := s.Int(0); v > 0 {
+		x = v
 	}
-	p.buffer.Cursor.Right(x)
+	p.checkRange(p.buffer.Cursor.X+x, p.buffer.Cursor.Y)
+	p.buffer.Right(x)
 	return
 }
 
@@ -80,27 +113,76 @@ func (p *ANSI) parseCUP(s *ANSISequence) (err error) {
 	case 1:
 		y = s.Int(0) - 1
 	}
-	p.buffer.Cursor.Goto(x, y)
+	p.checkRange(x, y)
+	p.buffer.Goto(x, y)
 	return
 }
 
+// Cursor Up
 func (p *ANSI) parseCUU(s *ANSISequence) (err error) {
+	y := 1
+	if v := s.Int(0); v > 0 {
+		y = v
+	}
+	p.buffer.Up(y)
+	return
+}
+
+// Device Attributes
+func (p *ANSI) parseDA(s *ANSISequence) (err error) {
+	if s.Int(0) == 0 {
+		err = p.reply(ANSI_REPLY_DA)
+	}
+	return
+}
+
+// Device Status Report
+func (p *ANSI) parseDSR(s *ANSISequence) (err error) {
+	switch s.Int(0) {
+	case ANSI_DSR_STATUS:
+		err = p.reply(ANSI_REPLY_STATUS_OK)
+	case ANSI_DSR_CPR:
+		x, y := p.buffer.ScreenPos()
+		err = p.reply(fmt.Sprintf(ANSI_REPLY_CPR, y+1, x+1))
+	}
+	return
+}
+
+// Set Top and Bottom Margins
+func (p *ANSI) parseDECSTBM(s *ANSISequence) (err error) {
+	t, b := 1, p.buffer.Height
+	if s.Len() > 0 && s.Int(0) > 0 {
+		t = s.Int(0)
+	}
+	if s.Len() > 1 && s.Int(1) > 0 {
+		b = s.Int(1)
+	}
+	p.buffer.SetMargins(t-1, b-1)
 	return
 }
 
 // Erase Display
 func (p *ANSI) parseED(s *ANSISequence) (err error) {
 	i := s.Int(0)
+	if p.profile.EraseAll {
+		i = 2
+	}
 
+	b := p.buffer
+	x, y := b.Cursor.Pos()
 	switch i {
 	case 0: // From cursor to EOF
-		o := p.buffer.Cursor.Offset(p.buffer.Width)
-		p.buffer.ClearFrom(o)
-	case 1: // From cursor to start
-		o := p.buffer.Cursor.Offset(p.buffer.Width)
-		p.buffer.ClearTo(o)
-	default: // Entire buffer
-		p.buffer.Clear()
+		b.ClearRect(buffer.Rect{X: x, Y: y, Width: b.Width - x, Height: 1})
+		b.ClearRect(buffer.Rect{X: 0, Y: y + 1, Width: b.Width, Height: b.Rows() - y - 1})
+	case 1: // From cursor to start of the screen
+		top := b.Scrollback()
+		b.ClearRect(buffer.Rect{X: 0, Y: top, Width: b.Width, Height: y - top})
+		b.ClearRect(buffer.Rect{X: 0, Y: y, Width: x + 1, Height: 1})
+	default: // Entire screen
+		b.ClearScreen()
+		if p.profile.ClearHome {
+			b.Goto(0, 0)
+		}
 	}
 
 	return
@@ -108,40 +190,36 @@ func (p *ANSI) parseED(s *ANSISequence) (err error) {
 
 // Erase Line
 func (p *ANSI) parseEL(s *ANSISequence) (err error) {
-	i := s.Int(0)
-	var o, e int
-	switch i {
+	b := p.buffer
+	x, y := b.Cursor.Pos()
+	switch s.Int(0) {
 	case 0: // To EOL
-		o = (p.buffer.Width * (p.buffer.Cursor.Y)) + p.buffer.Cursor.X
-		e = (p.buffer.Width * (p.buffer.Cursor.Y + 1)) - 1
+		b.ClearRect(buffer.Rect{X: x, Y: y, Width: b.Width - x, Height: 1})
 	case 1: // To BOL
-		o = (p.buffer.Width * (p.buffer.Cursor.Y - 1)) + 1
-		e = (p.buffer.Width * (p.buffer.Cursor.Y)) + p.buffer.Cursor.X
+		b.ClearRect(buffer.Rect{X: 0, Y: y, Width: x + 1, Height: 1})
 	case 2: // From BOL to EOL
-		o = (p.buffer.Width * (p.buffer.Cursor.Y - 1)) + 1
-		e = (p.buffer.Width * (p.buffer.Cursor.Y + 1)) - 1
-	}
-
-	o = calc.MaxInt(o, 0)
-	e = calc.MinInt(e, p.buffer.Len())
-
-	for i = o; i < e; i++ {
-		p.buffer.ClearAt(i)
+		b.ClearRect(buffer.Rect{X: 0, Y: y, Width: b.Width, Height: 1})
 	}
-
 	return
 }
 
 // Insert Line
 func (p *ANSI) parseIL(s *ANSISequence) (err error) {
 	i := 1
-	if s.Len() > 0 {
-		i = s.Int(0)
+	if v := s.Int(0); v > 0 {
+		i = v
 	}
-	o := p.buffer.Width * p.buffer.Normalize().Cursor.Y
-	for ; i > 0; i-- {
-		p.buffer.Insert(o, p.buffer.Width)
+	err = p.buffer.InsertLines(i)
+	return
+}
+
+// Scroll Down
+func (p *ANSI) parseSD(s *ANSISequence) (err error) {
+	n := 1
+	if v := s.Int(0); v > 0 {
+		n = v
 	}
+	p.buffer.ScrollDown(n)
 	return
 }
 
@@ -151,6 +229,7 @@ func (p *ANSI) parseSGR(s *ANSISequence) (err error) {
 		// ECMA-48 standard codes
 		case 0: // Default rendition
 			p.buffer.Cursor.ResetAttrib()
+			p.font = 0
 		case 1: // Bold
 			p.buffer.Cursor.Attrib |= buffer.ATTRIB_BOLD
 		case 2: // Faint
@@ -169,7 +248,7 @@ func (p *ANSI) parseSGR(s *ANSISequence) (err error) {
 		case 9: // Crossed-out
 			p.buffer.Cursor.Attrib |= buffer.ATTRIB_CROSS_OUT
 		case 10, 11, 12, 13, 14, 15, 16, 17, 18, 19:
-			p.buffer.Cursor.Font = n - 10
+			p.font = n - 10
 		case 20: // Fraktur (Gothic)
 			p.buffer.Cursor.Attrib |= buffer.ATTRIB_GOTHIC
 		case 21: // Doubly underlined
@@ -194,12 +273,12 @@ func (p *ANSI) parseSGR(s *ANSISequence) (err error) {
 		case 29: // Not crossed out
 			p.buffer.Cursor.Attrib &^= buffer.ATTRIB_CROSS_OUT
 		case 30, 31, 32, 33, 34, 35, 36, 37:
-			p.buffer.Cursor.Color = n - 30
+			p.buffer.Cursor.Color = uint8(n - 30)
 		case 38: // Reserved (TODO 24 bit ANSi)
 		case 39: // Default display colour
 			p.buffer.Cursor.Color = buffer.TILE_DEFAULT_COLOR
 		case 40, 41, 42, 43, 44, 45, 46, 47:
-			p.buffer.Cursor.Background = n - 40
+			p.buffer.Cursor.Background = uint8(n - 40)
 		case 48: // Reserved (TODO 24 bit ANSi)
 		case 49: // Default background colour
 			p.buffer.Cursor.Background = buffer.TILE_DEFAULT_BACKGROUND
@@ -235,14 +314,41 @@ func (p *ANSI) parseSGR(s *ANSISequence) (err error) {
 
 		// Non default aixterm codes
 		case 90, 91, 92, 93, 94, 95, 96, 97:
-			p.buffer.Cursor.Color = n - 90
+			p.buffer.Cursor.Color = uint8(n - 90)
 		case 100, 101, 102, 103, 104, 105, 106, 107:
-			p.buffer.Cursor.Background = n - 100
+			p.buffer.Cursor.Background = uint8(n - 100)
 
 		default: // Fallthrough
-			log.Printf("unsupported SGR %d\n", n)
+			p.Diagnose(DIAG_BAD_PARAMETER, "unsupported SGR %d", n)
 		}
 	}
 
+	p.updateFont()
 	return
 }
+
+// Scroll Up
+func (p *ANSI) parseSU(s *ANSISequence) (err error) {
+	n := 1
+	if v := s.Int(0); v > 0 {
+		n = v
+	}
+	p.buffer.ScrollUp(n)
+	return
+}
+
+// reply writes a response to a device query to the Reply writer, if any.
+func (p *ANSI) reply(r string) (err error) {
+	if p.Reply != nil {
+		_, err = io.WriteString(p.Reply, r)
+	}
+	return
+}
+
+// checkRange emits a diagnostic if column x or row y is outside of the canvas.
+// Rows are only limited in screen mode.
+func (p *ANSI) checkRange(x, y int) {
+	if x >= p.buffer.Width || (p.buffer.Mode() == buffer.MODE_SCREEN && y >= p.buffer.Height) {
+		p.Diagnose(DIAG_CURSOR_RANGE, "column %d, row %d", x+1, y+1)
+	}
+}
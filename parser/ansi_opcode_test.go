@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tehmaze-labs/go-piece/buffer"
+)
+
+// rows returns n rows of the buffer starting at row y as strings, a dot is
+// an unset tile.
+func rows(b *buffer.Buffer, y, n int) []string {
+	s := make([]string, n)
+	for i := range s {
+		row := b.Row(y + i)
+		if row == nil {
+			s[i] = strings.Repeat(".", b.Width)
+			continue
+		}
+		var r strings.Builder
+		for _, t := range row {
+			if t.Unset() {
+				r.WriteByte('.')
+			} else {
+				r.WriteRune(t.Rune)
+			}
+		}
+		s[i] = r.String()
+	}
+	return s
+}
+
+func TestDECSTBM(t *testing.T) {
+	const screen = "1\r\n2\r\n3\r\n4"
+	tests := []struct {
+		name       string
+		in         string
+		want       []string
+		scrollback int
+	}{
+		{"line feed in region", "\x1b[2;3r\x1b[3;1H\nx", []string{"1...", "3...", "x...", "4..."}, 0},
+		{"line feed below region", "\x1b[2;3r\x1b[4;1H\nx", []string{"1...", "2...", "3...", "x..."}, 0},
+		{"scroll up", "\x1b[2;3r\x1b[S", []string{"1...", "3...", "....", "4..."}, 0},
+		{"scroll down", "\x1b[2;3r\x1b[T", []string{"1...", "....", "2...", "4..."}, 0},
+		{"scroll more than region", "\x1b[2;3r\x1b[9S", []string{"1...", "....", "....", "4..."}, 0},
+		{"insert line", "\x1b[2;3r\x1b[2;1H\x1b[L", []string{"1...", "....", "2...", "4..."}, 0},
+		{"insert line outside region", "\x1b[2;3r\x1b[4;1H\x1b[L", []string{"1...", "2...", "3...", "4..."}, 0},
+		{"full screen", "\x1b[4;1H\nx", []string{"2...", "3...", "4...", "x..."}, 1},
+		{"reset region", "\x1b[2;3r\x1b[r\x1b[4;1H\nx", []string{"2...", "3...", "4...", "x..."}, 1},
+		{"invalid region", "\x1b[3;2r\x1b[4;1H\nx", []string{"2...", "3...", "4...", "x..."}, 1},
+	}
+	for _, test := range tests {
+		p := NewANSI(4, 4)
+		b := p.Buffer()
+		b.SetMode(buffer.MODE_SCREEN)
+		p.Write([]byte(screen + test.in))
+		if got := rows(b, b.Scrollback(), b.Height); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+		if n := b.Scrollback(); n != test.scrollback {
+			t.Errorf("%s: expected %d scrollback rows, got %d", test.name, test.scrollback, n)
+		}
+	}
+}
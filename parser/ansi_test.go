@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// largeInput returns a colored piece of 160 x 5000 tiles.
+func largeInput() []byte {
+	var b bytes.Buffer
+	for y := 0; y < 5000; y++ {
+		for x := 0; x < 160; x += 8 {
+			fmt.Fprintf(&b, "\x1b[%d;%dm\xdb\xb1\xb0 abcd", 30+(x+y)%8, 40+y%8)
+		}
+	}
+	return b.Bytes()
+}
+
+func BenchmarkANSILarge(b *testing.B) {
+	in := largeInput()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(in)))
+	for i := 0; i < b.N; i++ {
+		p := NewANSI(160, 25)
+		if _, err := p.Write(in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestANSILimits(t *testing.T) {
+	tests := []string{
+		"\x1b[115292150460684699;1Hx",
+		"\x1b[115292150460684699L",
+		"\x1b[115292150460684699Bx",
+		"\x1b[99999999999999999999999;99999999999999999999999Hx",
+	}
+	for _, in := range tests {
+		p := NewANSI(80, 25)
+		p.SetLimits(DefaultLimits)
+		p.Write([]byte(in))
+		if rows := p.Buffer().Rows(); rows > DefaultLimits.MaxHeight {
+			t.Errorf("%q: %d rows exceed the height limit", in, rows)
+		}
+		p.Buffer().Tiles()
+	}
+}
+
+func TestANSISequenceClamp(t *testing.T) {
+	s := NewANSISequence()
+	s.Load([]byte("115292150460684699;99999999999999999999999;12;x"))
+	if want, got := []int{ANSI_PARAM_MAX, ANSI_PARAM_MAX, 12}, s.Ints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if i := s.Int(0); i != ANSI_PARAM_MAX {
+		t.Errorf("expected %d, got %d", ANSI_PARAM_MAX, i)
+	}
+}
+
+func TestANSIDefaultLimitsLink(t *testing.T) {
+	uri := "https://example.com/" + strings.Repeat("a", 1000)
+	p := NewANSI(80, 25)
+	p.SetLimits(DefaultLimits)
+	if _, err := p.Write([]byte("\x1b]8;;" + uri + "\x1b\\link\x1b]8;;\x1b\\")); err != nil {
+		t.Fatal(err)
+	}
+	b := p.Buffer()
+	if got := b.Link(b.Row(0)[0].Link); got != uri {
+		t.Errorf("expected link %q, got %q", uri, got)
+	}
+	if s := p.String(); !strings.Contains(s, "link") {
+		t.Errorf("expected the link text, got %q", s)
+	}
+}
+
+func TestANSIPendingWrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		in      string
+		want    []string
+	}{
+		{"deferred", XtermProfile, "abcde", []string{"abcd", "e..."}},
+		{"deferred, CR LF", XtermProfile, "abcd\r\ne", []string{"abcd", "e..."}},
+		{"deferred, CR", XtermProfile, "abcd\re", []string{"ebcd"}},
+		{"deferred, LF", XtermProfile, "abcd\ne", []string{"abcd", "...e"}},
+		{"deferred, cursor left", XtermProfile, "abcd\x1b[De", []string{"abed"}},
+		{"immediate", ANSISYSProfile, "abcde", []string{"abcd", "e..."}},
+		{"immediate, CR LF", ANSISYSProfile, "abcd\r\ne", []string{"abcd", "....", "e..."}},
+		{"immediate, CR", ANSISYSProfile, "abcd\re", []string{"abcd", "e..."}},
+	}
+	for _, test := range tests {
+		p := NewANSI(4, 25)
+		p.SetProfile(test.profile)
+		p.Write([]byte(test.in))
+		b := p.Buffer()
+		_, h := b.SizeMax()
+		if got := rows(b, 0, h); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
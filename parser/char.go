@@ -38,8 +38,17 @@ const (
 
 	NL = LF
 	NP = FF
+
+	DEL = 0x7f
 )
 
+// IBM PC glyphs of the C0 control characters and DEL
+var controlGlyphs = [Space + 1]rune{
+	' ', '☺', '☻', '♥', '♦', '♣', '♠', '•', '◘', '○', '◙', '♂', '♀', '♪', '♫', '☼',
+	'►', '◄', '↕', '‼', '¶', '§', '▬', '↨', '↑', '↓', '→', '←', '∟', '↔', '▲', '▼',
+	'⌂',
+}
+
 func isAlpha(c byte) bool {
 	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
 }
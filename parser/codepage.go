@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// CodePage is a character set, with the glyph set that renderers use to draw
+// it. The glyph set is the name of a font, such as "cp437" or "topaz".
+type CodePage struct {
+	Name    string
+	Charmap *charmap.Charmap
+	Glyphs  string
+}
+
+var (
+	CodePage437 = CodePage{Name: "cp437", Charmap: charmap.CodePage437, Glyphs: "cp437"}
+	CodePage850 = CodePage{Name: "cp850", Charmap: charmap.CodePage850, Glyphs: "cp850"}
+	CodePage852 = CodePage{Name: "cp852", Charmap: charmap.CodePage852, Glyphs: "cp852"}
+	CodePage855 = CodePage{Name: "cp855", Charmap: charmap.CodePage855, Glyphs: "cp855"}
+	CodePage858 = CodePage{Name: "cp858", Charmap: charmap.CodePage858, Glyphs: "cp858"}
+	CodePage860 = CodePage{Name: "cp860", Charmap: charmap.CodePage860, Glyphs: "cp860"}
+	CodePage862 = CodePage{Name: "cp862", Charmap: charmap.CodePage862, Glyphs: "cp862"}
+	CodePage863 = CodePage{Name: "cp863", Charmap: charmap.CodePage863, Glyphs: "cp863"}
+	CodePage865 = CodePage{Name: "cp865", Charmap: charmap.CodePage865, Glyphs: "cp865"}
+	CodePage866 = CodePage{Name: "cp866", Charmap: charmap.CodePage866, Glyphs: "cp866"}
+	ISO8859_1   = CodePage{Name: "iso8859-1", Charmap: charmap.ISO8859_1, Glyphs: "cp819"}
+	AmigaTopaz  = CodePage{Name: "amiga", Charmap: charmap.ISO8859_1, Glyphs: "topaz"}
+	AmigaTopaz2 = CodePage{Name: "amiga-topaz2", Charmap: charmap.ISO8859_1, Glyphs: "topaz2"}
+	AmigaNoodle = CodePage{Name: "amiga-p0t-noodle", Charmap: charmap.ISO8859_1, Glyphs: "p0t-noodle"}
+	AmigaKnight = CodePage{Name: "amiga-microknight", Charmap: charmap.ISO8859_1, Glyphs: "microknight"}
+	AmigaMOsOul = CodePage{Name: "amiga-mosoul", Charmap: charmap.ISO8859_1, Glyphs: "mosoul"}
+	KOI8R       = CodePage{Name: "koi8-r", Charmap: charmap.KOI8R, Glyphs: "koi8-r"}
+	Windows1251 = CodePage{Name: "windows-1251", Charmap: charmap.Windows1251, Glyphs: "windows-1251"}
+	Windows1252 = CodePage{Name: "windows-1252", Charmap: charmap.Windows1252, Glyphs: "windows-1252"}
+	ISO8859_2   = CodePage{Name: "iso8859-2", Charmap: charmap.ISO8859_2, Glyphs: "iso8859-2"}
+	ISO8859_5   = CodePage{Name: "iso8859-5", Charmap: charmap.ISO8859_5, Glyphs: "iso8859-5"}
+	ISO8859_15  = CodePage{Name: "iso8859-15", Charmap: charmap.ISO8859_15, Glyphs: "iso8859-15"}
+	Macintosh   = CodePage{Name: "macintosh", Charmap: charmap.Macintosh, Glyphs: "macintosh"}
+
+	// DefaultCodePage is used by new parsers.
+	DefaultCodePage = CodePage437
+)
+
+// Stylesheets are the glyph sets that have a stylesheet in etc/, other glyph
+// sets fall back to the cp437 stylesheet.
+var Stylesheets = map[string]bool{
+	"cp437": true,
+}
+
+// CodePages are all known code pages by name.
+var CodePages = map[string]CodePage{}
+
+func init() {
+	for _, cp := range []CodePage{
+		CodePage437, CodePage850, CodePage852, CodePage855, CodePage858,
+		CodePage860, CodePage862, CodePage863, CodePage865, CodePage866,
+		ISO8859_1, AmigaTopaz, AmigaTopaz2, AmigaNoodle, AmigaKnight,
+		AmigaMOsOul, KOI8R, Windows1251, Windows1252, ISO8859_2, ISO8859_5,
+		ISO8859_15, Macintosh,
+	} {
+		CodePages[cp.Name] = cp
+	}
+}
+
+// LookupCodePage returns the code page with the given name, the name is not
+// case sensitive. Code page numbers, such as "866", are also accepted.
+func LookupCodePage(name string) (CodePage, bool) {
+	name = strings.ToLower(name)
+	if cp, ok := CodePages[name]; ok {
+		return cp, ok
+	}
+	cp, ok := CodePages["cp"+strings.TrimPrefix(name, "ibm")]
+	return cp, ok
+}
+
+// LookupFont returns the code page for a SAUCE font name, such as
+// "IBM VGA 866" or "Amiga Topaz 2+". IBM fonts without a code page use code
+// page 437. The second return value is false if the font or its code page is
+// not supported.
+func LookupFont(name string) (CodePage, bool) {
+	f := strings.Fields(strings.ToLower(name))
+	if len(f) < 2 {
+		return CodePage{}, false
+	}
+
+	switch f[0] {
+	case "ibm":
+		if len(f) == 2 {
+			return CodePage437, true
+		}
+		if f[2] == "819" {
+			return ISO8859_1, true
+		}
+		cp, ok := CodePages["cp"+f[2]]
+		return cp, ok
+
+	case "amiga":
+		switch strings.Join(f[1:], " ") {
+		case "topaz 1", "topaz 1+":
+			return AmigaTopaz, true
+		case "topaz 2", "topaz 2+":
+			return AmigaTopaz2, true
+		case "p0t-noodle":
+			return AmigaNoodle, true
+		case "microknight", "microknight+":
+			return AmigaKnight, true
+		case "mosoul":
+			return AmigaMOsOul, true
+		}
+	}
+	return CodePage{}, false
+}
+
+// Stylesheet returns the name of the stylesheet for the glyph set of the code
+// page, see Stylesheets.
+func (cp CodePage) Stylesheet() string {
+	if Stylesheets[cp.Glyphs] {
+		return cp.Glyphs + ".css"
+	}
+	return "cp437.css"
+}
+
+// CodePage returns the code page used to decode characters.
+func (p *ANSI) CodePage() CodePage {
+	return p.codepage
+}
+
+// SetCodePage sets the code page used to decode characters. The C0 control
+// characters that are drawn as characters are decoded as their IBM PC glyphs.
+func (p *ANSI) SetCodePage(cp CodePage) {
+	p.codepage = cp
+	for i := range p.decode {
+		p.decode[i] = cp.Charmap.DecodeByte(byte(i))
+	}
+	copy(p.decode[:], controlGlyphs[:Space])
+	p.decode[DEL] = controlGlyphs[Space]
+}
@@ -0,0 +1,269 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"path"
+	"strconv"
+
+	"github.com/tehmaze-labs/go-piece/buffer"
+)
+
+// CTerm font slots
+const (
+	CTERM_FONT_PRIMARY   = iota // default font
+	CTERM_FONT_SECONDARY        // selected with SGR 11
+	CTERM_FONT_BRIGHT           // used for bright characters if enabled
+	CTERM_FONT_BLINK            // used for blinking characters if enabled
+)
+
+// CTerm private modes
+const (
+	CTERM_MODE_AUTOWRAP    = 7   // auto wrap (DECAWM)
+	CTERM_MODE_BRIGHT_FONT = 31  // alternate font for bright characters
+	CTERM_MODE_BLINK_FONT  = 34  // alternate font for blinking characters
+	CTERM_MODE_DOORWAY     = 255 // DoorWay mode
+)
+
+// CTerm font sizes for loadable fonts
+const (
+	CTERM_FONT_SIZE_8X16 = iota
+	CTERM_FONT_SIZE_8X14
+	CTERM_FONT_SIZE_8X8
+)
+
+// CTERM_FONT_MAX is the highest font number that can be loaded
+const CTERM_FONT_MAX = 255
+
+// CTERM_APC is the prefix of the APC strings handled by CTerm
+const CTERM_APC = "SyncTERM:"
+
+// CTermFonts are the names of the fonts built into SyncTERM, indexed by font
+// number. Higher font numbers may be defined by loading a font.
+var CTermFonts = []string{
+	"Codepage 437 English",
+	"Codepage 1251 Cyrillic, (swiss)",
+	"Russian koi8-r",
+	"ISO-8859-2 Central European",
+	"ISO-8859-4 Baltic wide (VGA 9bit mapped)",
+	"Codepage 866 (c) Russian",
+	"ISO-8859-9 Turkish",
+	"haik8 codepage",
+	"ISO-8859-8 Hebrew",
+	"Ukrainian font koi8-u",
+	"ISO-8859-15 West European, (thin)",
+	"ISO-8859-4 Baltic (VGA 9bit mapped)",
+	"Russian koi8-r (b)",
+	"ISO-8859-4 Baltic wide",
+	"ISO-8859-5 Cyrillic",
+	"ARMSCII-8 Character set",
+	"ISO-8859-15 West European",
+	"Codepage 850 Multilingual Latin I, (thin)",
+	"Codepage 850 Multilingual Latin I",
+	"Codepage 865 Norwegian, (thin)",
+	"Codepage 1251 Cyrillic",
+	"ISO-8859-7 Greek",
+	"Russian koi8-r (c)",
+	"ISO-8859-4 Baltic",
+	"ISO-8859-1 West European",
+	"Codepage 866 Russian",
+	"Codepage 437 English, (thin)",
+	"Codepage 866 (b) Russian",
+	"Codepage 865 Norwegian",
+	"Ukrainian font cp866u",
+	"ISO-8859-1 West European, (thin)",
+	"Codepage 1131 Belarusian, (swiss)",
+	"Commodore 64 (UPPER)",
+	"Commodore 64 (Lower)",
+	"Commodore 128 (UPPER)",
+	"Commodore 128 (Lower)",
+	"Atari",
+	"P0T NOoDLE (Amiga)",
+	"mO'sOul (Amiga)",
+	"MicroKnight Plus (Amiga)",
+	"Topaz Plus (Amiga)",
+	"MicroKnight (Amiga)",
+	"Topaz (Amiga)",
+}
+
+// CTerm holds the state of the CTerm (SyncTERM) extensions. Tiles store the
+// font slot they were drawn with in Tile.Font, Fonts maps the slots to font
+// numbers.
+type CTerm struct {
+	Fonts      [4]int            // font number for each of the font slots
+	Loaded     map[int][]byte    // loaded font data by font number
+	Cache      map[string][]byte // files stored with APC cache commands
+	BrightFont bool              // draw bright characters in the bright font slot
+	BlinkFont  bool              // draw blinking characters in the blink font slot
+	DoorWay    bool              // DoorWay mode
+}
+
+// FontName returns the name of the font in font slot n.
+func (c *CTerm) FontName(n int) string {
+	if n < 0 || n >= len(c.Fonts) {
+		return ""
+	}
+	if f := c.Fonts[n]; f < len(CTermFonts) {
+		return CTermFonts[f]
+	} else if _, ok := c.Loaded[f]; ok {
+		return "Loaded font"
+	}
+	return ""
+}
+
+// Font Selection
+func (p *ANSI) parseCTermFont(s *ANSISequence) (err error) {
+	slot, font := s.Int(0), s.Int(1)
+	if slot < 0 || slot >= len(p.CTerm.Fonts) {
+		p.Diagnose(DIAG_BAD_PARAMETER, "font slot %d", slot)
+		return
+	}
+	if _, ok := p.CTerm.Loaded[font]; !ok && (font < 0 || font >= len(CTermFonts)) {
+		p.Diagnose(DIAG_BAD_PARAMETER, "font %d", font)
+		return
+	}
+	p.CTerm.Fonts[slot] = font
+	return
+}
+
+// Font Loading, the font data follows the sequence
+func (p *ANSI) parseCTermFontLoad(s *ANSISequence) (err error) {
+	font, size := s.Int(0), s.Int(1)
+	if font < len(CTermFonts) || font > CTERM_FONT_MAX {
+		p.Diagnose(DIAG_BAD_PARAMETER, "font %d", font)
+		return
+	}
+
+	var h int
+	switch size {
+	case CTERM_FONT_SIZE_8X16:
+		h = 16
+	case CTERM_FONT_SIZE_8X14:
+		h = 14
+	case CTERM_FONT_SIZE_8X8:
+		h = 8
+	default:
+		p.Diagnose(DIAG_BAD_PARAMETER, "font size %d", size)
+		return
+	}
+
+	p.ReadData(256*h, func(b []byte) error {
+		if p.CTerm.Loaded == nil {
+			p.CTerm.Loaded = make(map[int][]byte)
+		}
+		p.CTerm.Loaded[font] = append([]byte(nil), b...)
+		return nil
+	})
+	return
+}
+
+// fontHeight returns the glyph height of font data for 256 characters, or
+// zero if the size is not supported.
+func fontHeight(n int) int {
+	switch n {
+	case 256 * 16, 256 * 14, 256 * 8:
+		return n / 256
+	}
+	return 0
+}
+
+// parseCTermAPC handles the SyncTERM cache commands:
+//
+//	APC SyncTERM:C;S;filename;base64 data ST   store a file
+//	APC SyncTERM:C;D;pattern ST                delete files
+//	APC SyncTERM:C;SetFont;font;filename ST    load a font from a file
+//
+// Other commands are reported as unsupported.
+func (p *ANSI) parseCTermAPC(s []byte) (err error) {
+	args := bytes.Split(s[len(CTERM_APC):], []byte{';'})
+	if len(args) < 2 || string(args[0]) != "C" {
+		p.Diagnose(DIAG_UNSUPPORTED, "APC %q", s)
+		return
+	}
+
+	c := &p.CTerm
+	switch cmd := string(args[1]); {
+	case cmd == "S" && len(args) == 4:
+		name := string(args[2])
+		data, err := base64.StdEncoding.DecodeString(string(args[3]))
+		if err != nil || name == "" {
+			p.Diagnose(DIAG_BAD_PARAMETER, "cache file %q", name)
+			return nil
+		}
+		if c.Cache == nil {
+			c.Cache = make(map[string][]byte)
+		}
+		c.Cache[name] = data
+
+	case cmd == "D" && len(args) == 3:
+		pattern := string(args[2])
+		for name := range c.Cache {
+			if ok, _ := path.Match(pattern, name); ok {
+				delete(c.Cache, name)
+			}
+		}
+
+	case cmd == "SetFont" && len(args) == 4:
+		font, err := strconv.Atoi(string(args[2]))
+		if err != nil || font < len(CTermFonts) || font > CTERM_FONT_MAX {
+			p.Diagnose(DIAG_BAD_PARAMETER, "font %s", args[2])
+			return nil
+		}
+		data, ok := c.Cache[string(args[3])]
+		if !ok || fontHeight(len(data)) == 0 {
+			p.Diagnose(DIAG_BAD_PARAMETER, "font file %q", args[3])
+			return nil
+		}
+		if c.Loaded == nil {
+			c.Loaded = make(map[int][]byte)
+		}
+		c.Loaded[font] = data
+
+	default:
+		p.Diagnose(DIAG_UNSUPPORTED, "APC %q", s)
+	}
+	return
+}
+
+// Set Mode (private)
+func (p *ANSI) parseCTermSM(s *ANSISequence) (err error) {
+	return p.setCTermModes(s, true)
+}
+
+// Reset Mode (private)
+func (p *ANSI) parseCTermRM(s *ANSISequence) (err error) {
+	return p.setCTermModes(s, false)
+}
+
+func (p *ANSI) setCTermModes(s *ANSISequence, v bool) (err error) {
+	private := p.tok.Private
+	for _, m := range s.Ints() {
+		switch {
+		case private == '?' && m == CTERM_MODE_AUTOWRAP:
+			p.buffer.AutoWrap = v
+		case private == '?' && m == CTERM_MODE_BRIGHT_FONT:
+			p.CTerm.BrightFont = v
+		case private == '?' && m == CTERM_MODE_BLINK_FONT:
+			p.CTerm.BlinkFont = v
+		case private == '=' && m == CTERM_MODE_DOORWAY:
+			p.CTerm.DoorWay = v
+		default:
+			p.Diagnose(DIAG_BAD_PARAMETER, "unsupported mode %c%d", private, m)
+		}
+	}
+	p.updateFont()
+	return
+}
+
+// updateFont selects the font slot for the cursor, based on the selected font
+// and the bright and blink font modes.
+func (p *ANSI) updateFont() {
+	c := p.buffer.Cursor
+	c.Font = uint8(p.font)
+	if p.CTerm.BrightFont && c.Attrib&buffer.ATTRIB_BOLD != 0 {
+		c.Font = CTERM_FONT_BRIGHT
+	}
+	if p.CTerm.BlinkFont && c.Attrib&buffer.ATTRIB_BLINK != 0 {
+		c.Font = CTERM_FONT_BLINK
+	}
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestCTermAPC(t *testing.T) {
+	font := bytes.Repeat([]byte{0x18}, 256*16)
+	store := "\x1b_SyncTERM:C;S;font.f16;" + base64.StdEncoding.EncodeToString(font) + "\x1b\\"
+	tests := []struct {
+		name   string
+		in     string
+		loaded bool
+		diags  int
+	}{
+		{"store", store, false, 0},
+		{"set font", store + "\x1b_SyncTERM:C;SetFont;43;font.f16\x1b\\", true, 0},
+		{"select", store + "\x1b_SyncTERM:C;SetFont;43;font.f16\x1b\\\x1b[1;43 D", true, 0},
+		{"built in font", store + "\x1b_SyncTERM:C;SetFont;42;font.f16\x1b\\", false, 1},
+		{"font out of range", store + "\x1b_SyncTERM:C;SetFont;256;font.f16\x1b\\", false, 1},
+		{"missing file", "\x1b_SyncTERM:C;SetFont;43;font.f16\x1b\\", false, 1},
+		{"deleted file", store + "\x1b_SyncTERM:C;D;*.f16\x1b\\\x1b_SyncTERM:C;SetFont;43;font.f16\x1b\\", false, 1},
+		{"bad size", "\x1b_SyncTERM:C;S;font.f16;AAAA\x1b\\\x1b_SyncTERM:C;SetFont;43;font.f16\x1b\\", false, 1},
+		{"bad base64", "\x1b_SyncTERM:C;S;font.f16;!\x1b\\", false, 1},
+		{"unsupported", "\x1b_SyncTERM:Q;JXL\x1b\\", false, 1},
+	}
+	for _, test := range tests {
+		var diags DiagnosticList
+		p := NewANSI(80, 25)
+		p.SetLimits(DefaultLimits)
+		p.Diagnostics = &diags
+		if _, err := p.Write([]byte(test.in)); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if _, ok := p.CTerm.Loaded[43]; ok != test.loaded {
+			t.Errorf("%s: expected font loaded %t, got %t", test.name, test.loaded, ok)
+		}
+		if len(diags) != test.diags {
+			t.Errorf("%s: expected %d diagnostics, got %d", test.name, test.diags, len(diags))
+		}
+	}
+
+	p := NewANSI(80, 25)
+	p.Write([]byte(store + "\x1b_SyncTERM:C;SetFont;43;font.f16\x1b\\\x1b[1;43 D"))
+	if name := p.CTerm.FontName(1); name != "Loaded font" {
+		t.Errorf("expected the loaded font in slot 1, got %q", name)
+	}
+}
+
+func TestCTermAPCHook(t *testing.T) {
+	var got []string
+	p := NewANSI(80, 25)
+	p.APC = func(p *ANSI, s []byte) error {
+		got = append(got, string(s))
+		return nil
+	}
+	p.Write([]byte("\x1b_other\x1b\\\x1b_SyncTERM:C;D;*\x1b\\"))
+	if len(got) != 1 || got[0] != "other" {
+		t.Errorf("expected the hook to receive %q, got %q", "other", got)
+	}
+}
@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"math"
+	"unicode/utf8"
+
+	"github.com/tehmaze-labs/go-piece/calc"
+)
+
+// Common canvas widths, in order of preference
+var canvasWidths = []int{80, 132, 160}
+
+// line is the length of a line, newline is set if a CR or LF ends the line at
+// that length.
+type line struct {
+	n       int
+	newline bool
+}
+
+// DetectWidth guesses the canvas width of ANSI input without a SAUCE record,
+// it returns the width and the confidence of the guess between 0 and 1.
+//
+// The guess is based on the length of the lines, cursor forward movements and
+// cursor positioning. Lines that are longer than 80 columns are either a piece
+// drawn on a wider canvas, or an 80 column piece that relies on the automatic
+// wrap to the next line. The latter are recognized by a length that is a
+// multiple of 80 and that is not ended by a CR or LF at that length, or by a
+// length that exceeds any common width. Cursor forward movements past the
+// 80th column are a strong hint for a wider canvas, as ANSI.SYS stops the
+// cursor at the right margin.
+func DetectWidth(b []byte) (width int, confidence float64) {
+	var (
+		unicode = DetectUTF8(b)
+		seq     = NewANSISequence()
+		col     int // column of the cursor
+		max     int // maximum column on the current line
+		lines   []line
+		cross   int  // cursor movements past column 80
+		eol     bool // CR or LF at the end of the current line
+	)
+
+	endLine := func(newline bool) {
+		if max > 0 {
+			lines = append(lines, line{max, newline})
+		}
+		max, eol = col, false
+	}
+
+	l := NewLexer(func(t *Token) error {
+		switch t.Type {
+		case TOKEN_TEXT:
+			if unicode {
+				col += utf8.RuneCount(t.Raw)
+			} else {
+				col += len(t.Raw)
+			}
+		case TOKEN_CONTROL:
+			switch t.Final {
+			case LF:
+				endLine(eol || col == max)
+			case CR:
+				eol = eol || col == max
+				col = 0
+			case TAB:
+				col += ANSI_TABSTOP - col%ANSI_TABSTOP
+			default:
+				col++
+			}
+		case TOKEN_CSI:
+			if t.Private != 0 || len(t.Intermediate) > 0 {
+				break
+			}
+			seq.Load(t.Param)
+			n := seq.Int(0)
+			switch t.Final {
+			case ANSI_CUF:
+				if n < 1 {
+					n = 1
+				}
+				if col < 80 && col+n > 80 {
+					cross++
+				}
+				col += n
+			case ANSI_CUB:
+				if n < 1 {
+					n = 1
+				}
+				col -= n
+				if col < 0 {
+					col = 0
+				}
+			case ANSI_CHA:
+				col = n - 1
+			case ANSI_CUP, ANSI_HVP, ANSI_CUD, ANSI_CNL, ANSI_CUU, ANSI_CPL:
+				endLine(false)
+				switch t.Final {
+				case ANSI_CUP, ANSI_HVP:
+					col = seq.Int(1) - 1
+				case ANSI_CNL, ANSI_CPL:
+					col = 0
+				}
+				if col > 80 {
+					cross++
+				}
+			}
+			if col < 0 {
+				col = 0
+			}
+		}
+		if col > max {
+			max, eol = col, false
+		}
+		return nil
+	})
+	l.Write(b)
+	endLine(false)
+
+	if len(lines) == 0 {
+		return canvasWidths[0], 0
+	}
+
+	// Classify the lines that do not fit in 80 columns
+	var rows, wrapped, wide, widest int
+	for _, line := range lines {
+		n := line.n
+		rows += calc.MaxInt(1, n/80)
+		switch {
+		case n <= 80:
+		case n%80 == 0 && !line.newline, n > canvasWidths[len(canvasWidths)-1]:
+			wrapped++
+		default:
+			wide++
+			if n > widest {
+				widest = n
+			}
+		}
+	}
+	if cross > 0 {
+		wide += cross
+		if widest <= 80 {
+			widest = 81
+		}
+	}
+
+	// Confidence grows with the number of rows seen
+	sample := float64(rows) / float64(rows+5)
+
+	if wide == 0 || wrapped > wide {
+		return canvasWidths[0], sample * float64(len(lines)-wide) / float64(len(lines))
+	}
+
+	width = widest
+	for _, w := range canvasWidths {
+		if w >= widest {
+			width = w
+			break
+		}
+	}
+
+	// Confidence grows with the share of wide lines, cursor movements past
+	// column 80 count as wide lines
+	share := float64(wide) / float64(len(lines)+cross)
+	return width, sample * math.Min(1, share)
+}
@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// lines returns n lines of w columns, each ended by sep.
+func lines(n, w int, sep string) string {
+	return strings.Repeat(strings.Repeat("\xdb", w)+sep, n)
+}
+
+func TestDetectWidth(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		width     int
+		confident bool // confidence of at least 0.5
+	}{
+		{"80 columns", lines(20, 80, "\r\n"), 80, true},
+		{"80 columns, short lines", lines(20, 40, "\r\n"), 80, true},
+		{"80 columns, wrapped", lines(20, 80, ""), 80, true},
+		{"80 columns, wrapped rows", lines(20, 160, "\x1b[A"), 80, false},
+		{"80 columns, wrapped and ended", lines(10, 80, "") + "\r\n" + lines(10, 80, ""), 80, true},
+		{"80 columns, colored", strings.Repeat("\x1b[1;31m"+strings.Repeat("x", 79)+"\x1b[0m\r\n", 20), 80, true},
+		{"132 columns", lines(20, 132, "\r\n"), 132, true},
+		{"160 columns", lines(20, 160, "\r\n"), 160, true},
+		{"160 columns, mixed", lines(10, 160, "\r\n") + lines(10, 120, "\r\n"), 160, true},
+		{"160 columns, cursor forward", strings.Repeat("\x1b[150Cxx\r\n", 20), 160, true},
+		{"160 columns, mostly narrow", lines(30, 79, "\r\n") + lines(1, 160, "\r\n"), 160, false},
+		{"empty", "", 80, false},
+	}
+	for _, test := range tests {
+		width, confidence := DetectWidth([]byte(test.in))
+		if width != test.width {
+			t.Errorf("%s: expected width %d, got %d", test.name, test.width, width)
+		}
+		if confidence < 0 || confidence > 1 {
+			t.Errorf("%s: confidence %f out of range", test.name, confidence)
+		} else if (confidence >= 0.5) != test.confident {
+			t.Errorf("%s: expected confident %t, got confidence %.2f", test.name, test.confident, confidence)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diagnostic kinds
+const (
+	DIAG_UNSUPPORTED   = iota // unsupported control sequence
+	DIAG_BAD_PARAMETER        // unsupported or malformed parameter
+	DIAG_CURSOR_RANGE         // cursor moved outside of the canvas
+	DIAG_ERROR                // error returned by a sequence handler
+)
+
+var diagnosticKinds = map[int]string{
+	DIAG_UNSUPPORTED:   "unsupported sequence",
+	DIAG_BAD_PARAMETER: "bad parameter",
+	DIAG_CURSOR_RANGE:  "cursor out of range",
+	DIAG_ERROR:         "error",
+}
+
+// Diagnostic describes a problem encountered in the input.
+type Diagnostic struct {
+	Kind    int
+	Offset  int64  // byte offset of the sequence in the input
+	X, Y    int    // cursor column and row
+	Raw     []byte // raw bytes of the sequence
+	Message string
+}
+
+func (d *Diagnostic) String() string {
+	s := fmt.Sprintf("offset %d (row %d, column %d): %s %s",
+		d.Offset, d.Y+1, d.X+1, diagnosticKinds[d.Kind],
+		strings.Replace(string(d.Raw), "\x1b", "<ESC>", -1))
+	if d.Message != "" {
+		s += ": " + d.Message
+	}
+	return s
+}
+
+// DiagnosticSink receives diagnostics emitted by the parser.
+type DiagnosticSink interface {
+	Diagnostic(d *Diagnostic)
+}
+
+// DiagnosticFunc is an adapter to use an ordinary function as DiagnosticSink.
+type DiagnosticFunc func(d *Diagnostic)
+
+// Diagnostic calls f(d).
+func (f DiagnosticFunc) Diagnostic(d *Diagnostic) {
+	f(d)
+}
+
+// DiagnosticList is a DiagnosticSink that collects all diagnostics.
+type DiagnosticList []*Diagnostic
+
+// Diagnostic appends d to the list.
+func (l *DiagnosticList) Diagnostic(d *Diagnostic) {
+	*l = append(*l, d)
+}
+
+// Count returns the number of collected diagnostics of kind k.
+func (l DiagnosticList) Count(k int) (n int) {
+	for _, d := range l {
+		if d.Kind == k {
+			n++
+		}
+	}
+	return
+}
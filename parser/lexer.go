@@ -0,0 +1,380 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tehmaze-labs/go-piece/buffer"
+	"github.com/tehmaze-labs/go-piece/calc"
+)
+
+// Token types
+const (
+	TOKEN_TEXT    = iota // run of printable characters
+	TOKEN_CONTROL        // C0 control character
+	TOKEN_CSI            // control sequence, ESC [
+	TOKEN_ESC            // escape sequence
+	TOKEN_OSC            // operating system command, ESC ]
+	TOKEN_EOF            // end of file, SUB
+	TOKEN_INVALID        // malformed or interrupted sequence
+	TOKEN_APC            // application program command, ESC _
+	TOKEN_DATA           // binary data requested with Lexer.Data
+)
+
+var tokenTypes = map[int]string{
+	TOKEN_TEXT:    "text",
+	TOKEN_CONTROL: "control",
+	TOKEN_CSI:     "CSI",
+	TOKEN_ESC:     "ESC",
+	TOKEN_OSC:     "OSC",
+	TOKEN_EOF:     "EOF",
+	TOKEN_INVALID: "invalid",
+	TOKEN_APC:     "APC",
+	TOKEN_DATA:    "data",
+}
+
+// Token is a lexical element of ANSI input.
+type Token struct {
+	Type         int
+	Offset       int64  // byte offset of the token in the input
+	Raw          []byte // raw bytes of the token
+	Private      byte   // private parameter prefix of a CSI, '<', '=', '>' or '?'
+	Param        []byte // parameter bytes of a CSI, or the string of an OSC or APC
+	Intermediate []byte // intermediate bytes of a CSI or ESC sequence
+	Final        byte   // final byte of a CSI or ESC sequence, or the C0 control
+}
+
+func (t *Token) String() string {
+	return fmt.Sprintf("%s %q", tokenTypes[t.Type], t.Raw)
+}
+
+// TokenFunc receives tokens from the Lexer. The token and its byte slices are
+// only valid until the function returns. Returning an error stops the lexer.
+type TokenFunc func(t *Token) error
+
+// Lexer splits ANSI input into tokens. Input may be written in chunks of any
+// size, the lexer keeps its state between writes. Runs of text are split at
+// chunk boundaries.
+type Lexer struct {
+	// MaxSequence is the maximum length of a control sequence, zero means no
+	// limit.
+	MaxSequence int
+
+	// MaxString is the maximum length of an OSC or APC control string, zero
+	// means no limit.
+	MaxString int
+
+	fn     TokenFunc
+	state  int
+	offset int64
+	start  int64 // offset of the pending sequence
+	raw    []byte
+	inter  int // index of the first intermediate byte in raw
+	str    int // token type of the pending control string
+	data   int // number of pending data bytes
+	delim  int // delimiter of pending data, or -1
+	tok    Token
+}
+
+// NewLexer creates a lexer that sends all tokens to fn.
+func NewLexer(fn TokenFunc) *Lexer {
+	return &Lexer{
+		fn:    fn,
+		state: STATE_TEXT,
+		raw:   make([]byte, 0, 32),
+		delim: -1,
+	}
+}
+
+// Done returns true if the lexer has seen the end of file marker.
+func (l *Lexer) Done() bool {
+	return l.state == STATE_EXIT
+}
+
+// Offset returns the number of bytes written to the lexer.
+func (l *Lexer) Offset() int64 {
+	return l.offset
+}
+
+// Data makes the lexer emit the next n bytes of input as a single TOKEN_DATA
+// token, without interpreting them. It can be called from the TokenFunc for
+// sequences that are followed by binary data.
+func (l *Lexer) Data(n int) {
+	if n > 0 {
+		l.raw = l.raw[:0]
+		l.data = n
+		l.delim = -1
+		l.state = STATE_DATA
+	}
+}
+
+// DataUntil is like Data, but the data ends with the delimiter, which is
+// included in the token. At most max bytes are read if no delimiter is found.
+func (l *Lexer) DataUntil(delim byte, max int) {
+	l.Data(max)
+	l.delim = int(delim)
+}
+
+// Reset discards any pending sequence and returns the lexer to its initial
+// state.
+func (l *Lexer) Reset() {
+	l.state = STATE_TEXT
+	l.offset = 0
+	l.raw = l.raw[:0]
+	l.inter = 0
+	l.data = 0
+	l.delim = -1
+}
+
+// Write implements io.Writer, it splits b into tokens. Input following a SUB
+// is discarded.
+func (l *Lexer) Write(b []byte) (n int, err error) {
+	var i int
+	text := -1 // start of the pending run of text
+	for ; i < len(b) && err == nil; i++ {
+		ch := b[i]
+
+		if l.state == STATE_DATA {
+			if len(l.raw) == 0 {
+				l.start = l.offset + int64(i)
+			}
+			n := calc.MinInt(l.data, len(b)-i)
+			if l.delim >= 0 {
+				if j := bytes.IndexByte(b[i:i+n], byte(l.delim)); j >= 0 {
+					n = j + 1
+					l.data = n
+				}
+			}
+			l.raw = append(l.raw, b[i:i+n]...)
+			l.data -= n
+			i += n - 1
+			if l.data == 0 {
+				l.delim = -1
+				err = l.emitSequence(TOKEN_DATA)
+			}
+			continue
+		}
+
+		if l.state == STATE_TEXT && ch >= Space {
+			if text < 0 {
+				text = i
+			}
+			continue
+		}
+		if text >= 0 {
+			if err = l.emitText(b[text:i], int64(text)); err != nil {
+				return l.advance(i), err
+			}
+			text = -1
+		}
+
+		switch l.state {
+		case STATE_EXIT:
+			l.advance(i)
+			return len(b), nil
+
+		case STATE_TEXT:
+			switch ch {
+			case SUB:
+				err = l.emitByte(TOKEN_EOF, b, i)
+				l.state = STATE_EXIT
+			case ESC:
+				l.begin(ch, int64(i))
+			default:
+				err = l.emitByte(TOKEN_CONTROL, b, i)
+			}
+			continue
+
+		case STATE_STRING:
+			switch {
+			case ch == BEL && l.str == TOKEN_OSC:
+				l.raw = append(l.raw, ch)
+				err = l.emitString(1)
+				continue
+			case ch == ESC:
+				l.raw = append(l.raw, ch)
+				l.state = STATE_STRING_ESC
+				continue
+			case ch == CAN, ch == SUB:
+			default:
+				err = l.pushString(ch)
+				continue
+			}
+
+		case STATE_STRING_ESC:
+			if ch == '\\' {
+				l.raw = append(l.raw, ch)
+				err = l.emitString(2)
+			} else {
+				// Unterminated string, restart at the escape
+				l.raw = l.raw[:len(l.raw)-1]
+				if err = l.emitSequence(TOKEN_INVALID); err == nil {
+					l.begin(ESC, int64(i-1))
+					i--
+				}
+			}
+			continue
+		}
+
+		// Sequence states, C0 controls are executed inside sequences
+		switch {
+		case ch == CAN:
+			err = l.emitSequence(TOKEN_INVALID)
+			continue
+		case ch == SUB || ch == ESC:
+			err = l.emitSequence(TOKEN_INVALID)
+			i--
+			continue
+		case ch < Space:
+			err = l.emitByte(TOKEN_CONTROL, b, i)
+			continue
+		case ch > '~':
+			err = l.emitSequence(TOKEN_INVALID)
+			i--
+			continue
+		}
+
+		if err = l.push(ch); err != nil {
+			break
+		}
+
+		switch l.state {
+		case STATE_ANSI_WAIT_BRACE:
+			switch {
+			case ch == '[':
+				l.state = STATE_ANSI_WAIT_LITERAL
+			case ch == ']':
+				l.str = TOKEN_OSC
+				l.state = STATE_STRING
+			case ch == '_':
+				l.str = TOKEN_APC
+				l.state = STATE_STRING
+			case ch < '0':
+				l.inter = len(l.raw) - 1
+				l.state = STATE_ESC_INTERMEDIATE
+			default:
+				err = l.emitSequence(TOKEN_ESC)
+			}
+
+		case STATE_ESC_INTERMEDIATE:
+			if ch >= '0' {
+				err = l.emitSequence(TOKEN_ESC)
+			}
+
+		case STATE_ANSI_WAIT_LITERAL:
+			switch {
+			case ch < '0': // Intermediate byte
+				if l.inter == 0 {
+					l.inter = len(l.raw) - 1
+				}
+			case ch < '@': // Parameter byte
+				if l.inter > 0 {
+					err = l.emitSequence(TOKEN_INVALID)
+				}
+			default:
+				err = l.emitSequence(TOKEN_CSI)
+			}
+		}
+	}
+
+	if err != nil {
+		return l.advance(i), err
+	}
+	if text >= 0 {
+		if err = l.emitText(b[text:], int64(text)); err != nil {
+			return l.advance(len(b)), err
+		}
+	}
+	l.advance(len(b))
+	return len(b), nil
+}
+
+// advance moves the input offset forward by n bytes.
+func (l *Lexer) advance(n int) int {
+	l.offset += int64(n)
+	return n
+}
+
+// begin starts a new sequence.
+func (l *Lexer) begin(ch byte, i int64) {
+	l.raw = append(l.raw[:0], ch)
+	l.inter = 0
+	l.start = l.offset + i
+	l.state = STATE_ANSI_WAIT_BRACE
+}
+
+// push adds a byte to the pending sequence.
+func (l *Lexer) push(ch byte) error {
+	l.raw = append(l.raw, ch)
+	if l.MaxSequence > 0 && len(l.raw) > l.MaxSequence {
+		return &buffer.LimitError{
+			Limit: "sequence",
+			Value: int64(len(l.raw)),
+			Max:   int64(l.MaxSequence),
+		}
+	}
+	return nil
+}
+
+// pushString adds a byte to the pending control string.
+func (l *Lexer) pushString(ch byte) error {
+	l.raw = append(l.raw, ch)
+	if l.MaxString > 0 && len(l.raw) > l.MaxString {
+		return &buffer.LimitError{
+			Limit: "string",
+			Value: int64(len(l.raw)),
+			Max:   int64(l.MaxString),
+		}
+	}
+	return nil
+}
+
+func (l *Lexer) emitText(b []byte, i int64) error {
+	l.tok = Token{Type: TOKEN_TEXT, Offset: l.offset + i, Raw: b}
+	return l.fn(&l.tok)
+}
+
+func (l *Lexer) emitByte(t int, b []byte, i int) error {
+	l.tok = Token{Type: t, Offset: l.offset + int64(i), Raw: b[i : i+1], Final: b[i]}
+	return l.fn(&l.tok)
+}
+
+// emitString emits the pending control string, terminated by n bytes.
+func (l *Lexer) emitString(n int) error {
+	l.state = STATE_TEXT
+	l.tok = Token{
+		Type:   l.str,
+		Offset: l.start,
+		Raw:    l.raw,
+		Param:  l.raw[2 : len(l.raw)-n],
+	}
+	return l.fn(&l.tok)
+}
+
+// emitSequence emits the pending sequence as token type t.
+func (l *Lexer) emitSequence(t int) error {
+	l.state = STATE_TEXT
+	l.tok = Token{Type: t, Offset: l.start, Raw: l.raw}
+	r := l.raw
+	switch t {
+	case TOKEN_ESC:
+		l.tok.Final = r[len(r)-1]
+		if l.inter > 0 {
+			l.tok.Intermediate = r[l.inter : len(r)-1]
+		}
+	case TOKEN_CSI:
+		e := len(r) - 1
+		l.tok.Final = r[e]
+		if l.inter > 0 {
+			l.tok.Intermediate = r[l.inter:e]
+			e = l.inter
+		}
+		s := 2
+		if s < e && r[s] >= '<' && r[s] <= '?' {
+			l.tok.Private = r[s]
+			s++
+		}
+		l.tok.Param = r[s:e]
+	}
+	return l.fn(&l.tok)
+}
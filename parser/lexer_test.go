@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lex writes the chunks to a new lexer and returns the tokens as strings,
+// adjacent runs of text are joined.
+func lex(chunks ...string) []string {
+	var tokens []string
+	var text string
+	l := NewLexer(func(t *Token) error {
+		if t.Type == TOKEN_TEXT {
+			text += string(t.Raw)
+			return nil
+		}
+		if text != "" {
+			tokens = append(tokens, fmt.Sprintf("text %q", text))
+			text = ""
+		}
+		s := t.String()
+		switch t.Type {
+		case TOKEN_CSI:
+			s += fmt.Sprintf(" %q %q %q %q", t.Private, t.Param, t.Intermediate, t.Final)
+		case TOKEN_ESC:
+			s += fmt.Sprintf(" %q %q", t.Intermediate, t.Final)
+		case TOKEN_OSC, TOKEN_APC:
+			s += fmt.Sprintf(" %q", t.Param)
+		}
+		tokens = append(tokens, s)
+		return nil
+	})
+	for _, chunk := range chunks {
+		l.Write([]byte(chunk))
+	}
+	if text != "" {
+		tokens = append(tokens, fmt.Sprintf("text %q", text))
+	}
+	return tokens
+}
+
+func TestLexer(t *testing.T) {
+	tests := []struct {
+		in     string
+		tokens []string
+	}{
+		{"hello", []string{`text "hello"`}},
+		{"a\r\nb", []string{`text "a"`, `control "\r"`, `control "\n"`, `text "b"`}},
+		{"\x1b[1;31mx", []string{`CSI "\x1b[1;31m" '\x00' "1;31" "" 'm'`, `text "x"`}},
+		{"\x1b[?25h", []string{`CSI "\x1b[?25h" '?' "25" "" 'h'`}},
+		{"\x1b[0 D", []string{`CSI "\x1b[0 D" '\x00' "0" " " 'D'`}},
+		{"\x1b[1 2m", []string{`invalid "\x1b[1 2"`, `text "m"`}},
+		{"\x1b(B", []string{`ESC "\x1b(B" "(" 'B'`}},
+		{"\x1b7", []string{`ESC "\x1b7" "" '7'`}},
+		{"\x1b]0;title\x07", []string{`OSC "\x1b]0;title\a" "0;title"`}},
+		{"\x1b]0;title\x1b\\", []string{`OSC "\x1b]0;title\x1b\\" "0;title"`}},
+		{"\x1b_apc\x1b\\", []string{`APC "\x1b_apc\x1b\\" "apc"`}},
+		{"\x1b]0;x\x1b[m", []string{`invalid "\x1b]0;x"`, `CSI "\x1b[m" '\x00' "" "" 'm'`}},
+		{"\x1b[1\x18x", []string{`invalid "\x1b[1"`, `text "x"`}},
+		{"\x1b[1\x1b[2m", []string{`invalid "\x1b[1"`, `CSI "\x1b[2m" '\x00' "2" "" 'm'`}},
+		{"\x1b[1\r2m", []string{`control "\r"`, `CSI "\x1b[12m" '\x00' "12" "" 'm'`}},
+		{"ab\x1ac", []string{`text "ab"`, `EOF "\x1a"`}},
+	}
+	for _, test := range tests {
+		if got := lex(test.in); !reflect.DeepEqual(got, test.tokens) {
+			t.Errorf("%q: expected %q, got %q", test.in, test.tokens, got)
+		}
+	}
+}
+
+func TestLexerChunks(t *testing.T) {
+	tests := []string{
+		"ab\x1b[1;31mcd\x1b[0m\r\n",
+		"\x1b]8;;http://example.com/\x1b\\link\x1b]8;;\x1b\\",
+		"\x1b[?25h\x1b(B\x1b[0 D\x1b_apc\x1b\\x",
+		"\x1b[1\x1b[2mx\x1b]0;t\x07",
+	}
+	for _, in := range tests {
+		want := lex(in)
+		for i := 1; i < len(in); i++ {
+			if got := lex(in[:i], in[i:]); !reflect.DeepEqual(got, want) {
+				t.Errorf("%q split at %d: expected %q, got %q", in, i, want, got)
+			}
+		}
+		var bytes []string
+		for i := range in {
+			bytes = append(bytes, in[i:i+1])
+		}
+		if got := lex(bytes...); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q byte by byte: expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestLexerOffset(t *testing.T) {
+	var offsets []int64
+	l := NewLexer(func(t *Token) error {
+		offsets = append(offsets, t.Offset)
+		return nil
+	})
+	l.Write([]byte("ab\x1b["))
+	l.Write([]byte("1mcd"))
+	if want := []int64{0, 2, 6}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("expected offsets %v, got %v", want, offsets)
+	}
+	if l.Offset() != 8 {
+		t.Errorf("expected offset 8, got %d", l.Offset())
+	}
+}
+
+func TestLexerMaxSequence(t *testing.T) {
+	l := NewLexer(func(t *Token) error { return nil })
+	l.MaxSequence = 8
+	if _, err := l.Write([]byte("\x1b[1;2;3;4;5m")); err == nil {
+		t.Error("expected a limit error")
+	}
+}
+
+func TestLexerMaxString(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"\x1b]8;;http://example.com/\x1b\\", true},
+		{"\x1b]8;;http://example.com/" + strings.Repeat("x", 64) + "\x1b\\", false},
+		{"\x1b_" + strings.Repeat("x", 64) + "\x1b\\", false},
+		{"\x1b[" + strings.Repeat("1;", 20) + "m", false},
+	}
+	for _, test := range tests {
+		l := NewLexer(func(t *Token) error { return nil })
+		l.MaxSequence = 8
+		l.MaxString = 64
+		if _, err := l.Write([]byte(test.in)); (err == nil) != test.ok {
+			t.Errorf("%q: expected ok %t, got error %v", test.in, test.ok, err)
+		}
+	}
+}
+
+func TestLexerData(t *testing.T) {
+	var data []string
+	var l *Lexer
+	l = NewLexer(func(t *Token) error {
+		switch t.Type {
+		case TOKEN_CSI:
+			l.Data(3)
+		case TOKEN_DATA:
+			data = append(data, string(t.Raw))
+		}
+		return nil
+	})
+	l.Write([]byte("\x1b[xa\x1b"))
+	l.Write([]byte("bcd"))
+	if want := []string{"a\x1bb"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("expected data %q, got %q", want, data)
+	}
+}
@@ -0,0 +1,32 @@
+package parser
+
+// ANSI Music, the music string following the sequence is terminated by SO.
+// BananaCom music starts with CSI M or CSI N, which are only recognised
+// without parameters.
+func (p *ANSI) parseMusic(s *ANSISequence) (err error) {
+	t, m := p.tok, p.profile.ANSIMusic
+	if m == MUSIC_OFF || (t.Final != ANSI_MUSIC && (m != MUSIC_BANANACOM || len(t.Param) > 0)) {
+		p.Diagnose(DIAG_UNSUPPORTED, "")
+		return
+	}
+
+	offset, final := t.Offset, t.Final
+	p.ReadUntil(SO, ANSI_MUSIC_MAX, func(b []byte) error {
+		if n := len(b); n > 0 && b[n-1] == SO {
+			b = b[:n-1]
+		}
+		if final == ANSI_DL && len(b) > 0 {
+			// The M of the sequence may be the start of a music mode, MF
+			// or MB for foreground or background music.
+			switch b[0] {
+			case 'F', 'B', 'N', 'L', 'S', 'f', 'b', 'n', 'l', 's':
+				b = append([]byte{'M'}, b...)
+			}
+		}
+		tune := p.mml.Parse(b)
+		tune.Offset = offset
+		p.Music = append(p.Music, tune)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Operating System Commands
+const (
+	OSC_ICON_TITLE = 0 // set icon name and window title
+	OSC_ICON       = 1 // set icon name
+	OSC_TITLE      = 2 // set window title
+	OSC_HYPERLINK  = 8 // hyperlink
+)
+
+// Hyperlink schemes that are rendered as links
+var linkSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"ftp":    true,
+	"gopher": true,
+	"telnet": true,
+	"mailto": true,
+}
+
+// Operating System Command
+func (p *ANSI) parseOSC(b []byte) (err error) {
+	var arg []byte
+	if i := bytes.IndexByte(b, ';'); i >= 0 {
+		b, arg = b[:i], b[i+1:]
+	}
+	n, err := strconv.Atoi(string(b))
+	if err != nil {
+		p.Diagnose(DIAG_BAD_PARAMETER, "OSC %q", b)
+		return nil
+	}
+
+	switch n {
+	case OSC_ICON_TITLE, OSC_TITLE:
+		p.Title = string(arg)
+	case OSC_ICON:
+	case OSC_HYPERLINK:
+		// OSC 8 ; params ; URI, an empty URI ends the link
+		i := bytes.IndexByte(arg, ';')
+		if i < 0 {
+			p.Diagnose(DIAG_BAD_PARAMETER, "malformed hyperlink")
+			break
+		}
+		if uri := string(arg[i+1:]); uri == "" {
+			p.buffer.Cursor.Link = 0
+		} else {
+			p.buffer.Cursor.Link = p.buffer.AddLink(uri)
+		}
+	default:
+		p.Diagnose(DIAG_UNSUPPORTED, "")
+	}
+	return
+}
+
+// isSafeLink checks if the hyperlink target can be rendered as a link.
+func isSafeLink(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && linkSchemes[strings.ToLower(u.Scheme)]
+}
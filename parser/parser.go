@@ -1,8 +1,29 @@
 package parser
 
+import (
+	"context"
+	"io"
+)
+
+// Parser reads a piece and draws it on a buffer.
+type Parser interface {
+	// Parse reads from r until the end of the piece.
+	Parse(r io.Reader) error
+
+	// ParseContext is like Parse, but stops when ctx is cancelled.
+	ParseContext(ctx context.Context, r io.Reader) error
+}
+
 const (
 	STATE_EXIT = iota
 	STATE_TEXT
 	STATE_ANSI_WAIT_BRACE
 	STATE_ANSI_WAIT_LITERAL
+	STATE_ESC_INTERMEDIATE
+	STATE_STRING
+	STATE_STRING_ESC
+	STATE_DATA
 )
+
+// Interface check
+var _ Parser = (*ANSI)(nil)
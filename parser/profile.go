@@ -0,0 +1,107 @@
+package parser
+
+import "strings"
+
+// ANSI music modes
+const (
+	MUSIC_OFF       = iota // no ANSI music
+	MUSIC_CTERM            // ANSI music with CSI |
+	MUSIC_BANANACOM        // ANSI music with CSI |, CSI M and CSI N
+)
+
+// Profile configures the behaviour of the terminal that is emulated. Viewers
+// disagree on a number of details, a profile makes the parser render a piece
+// the way it looked in a particular viewer.
+type Profile struct {
+	Name string
+
+	// AutoWrap moves the cursor to the next line after writing in the last
+	// column. If disabled, the cursor stays in the last column.
+	AutoWrap bool
+
+	// DeferWrap defers the wrap to the next line until the next character
+	// is written, so a CR/LF directly after the last column does not result
+	// in an empty line.
+	DeferWrap bool
+
+	// NewLine makes a line feed also return the cursor to the first column.
+	NewLine bool
+
+	// EraseAll makes any erase in display clear the whole screen, regardless
+	// of the parameter.
+	EraseAll bool
+
+	// ClearHome moves the cursor to the home position after the whole
+	// screen is erased.
+	ClearHome bool
+
+	// ANSIMusic selects which sequences introduce ANSI music.
+	ANSIMusic int
+}
+
+var (
+	// ANSISYSProfile emulates the MS-DOS ANSI.SYS driver.
+	ANSISYSProfile = Profile{
+		Name:      "ansi.sys",
+		AutoWrap:  true,
+		EraseAll:  true,
+		ClearHome: true,
+		ANSIMusic: MUSIC_BANANACOM,
+	}
+
+	// SyncTERMProfile emulates the SyncTERM (CTerm) BBS client.
+	SyncTERMProfile = Profile{
+		Name:      "syncterm",
+		AutoWrap:  true,
+		DeferWrap: true,
+		ClearHome: true,
+		ANSIMusic: MUSIC_CTERM,
+	}
+
+	// XtermProfile emulates xterm and other VT100 compatible terminals.
+	XtermProfile = Profile{
+		Name:      "xterm",
+		AutoWrap:  true,
+		DeferWrap: true,
+	}
+
+	// NetRunnerProfile emulates the NetRunner BBS client.
+	NetRunnerProfile = Profile{
+		Name:      "netrunner",
+		AutoWrap:  true,
+		DeferWrap: true,
+		NewLine:   true,
+		ClearHome: true,
+		ANSIMusic: MUSIC_BANANACOM,
+	}
+
+	// DefaultProfile is used by new parsers.
+	DefaultProfile = ANSISYSProfile
+)
+
+// Profiles are all known profiles by name.
+var Profiles = map[string]Profile{
+	ANSISYSProfile.Name:   ANSISYSProfile,
+	SyncTERMProfile.Name:  SyncTERMProfile,
+	XtermProfile.Name:     XtermProfile,
+	NetRunnerProfile.Name: NetRunnerProfile,
+}
+
+// LookupProfile returns the profile with the given name, the name is not case
+// sensitive.
+func LookupProfile(name string) (Profile, bool) {
+	p, ok := Profiles[strings.ToLower(name)]
+	return p, ok
+}
+
+// Profile returns the emulation profile of the parser.
+func (p *ANSI) Profile() Profile {
+	return p.profile
+}
+
+// SetProfile changes the emulation profile of the parser.
+func (p *ANSI) SetProfile(pr Profile) {
+	p.profile = pr
+	p.buffer.AutoWrap = pr.AutoWrap
+	p.buffer.DeferWrap = pr.DeferWrap
+}
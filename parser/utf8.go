@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// Zero-width characters that are not combining marks
+const (
+	ZWNJ = 0x200c // zero width non-joiner
+	ZWJ  = 0x200d // zero width joiner
+	VS16 = 0xfe0f // variation selector-16
+)
+
+// UTF8 returns if the text input is decoded as UTF-8.
+func (p *ANSI) UTF8() bool {
+	return p.utf8
+}
+
+// SetUTF8 selects UTF-8 decoding of the text input instead of decoding through
+// the code page. Control sequences are not affected.
+func (p *ANSI) SetUTF8(enable bool) {
+	p.utf8 = enable
+}
+
+// DetectUTF8 checks if b looks like UTF-8 encoded input: it must be valid
+// UTF-8 and contain at least one multibyte character. An incomplete character
+// at the end of b is ignored.
+func DetectUTF8(b []byte) bool {
+	var multi bool
+	for len(b) > 0 {
+		r, n := utf8.DecodeRune(b)
+		if r == utf8.RuneError && n <= 1 {
+			return !utf8.FullRune(b) && multi
+		}
+		multi = multi || n > 1
+		b = b[n:]
+	}
+	return multi
+}
+
+// putUTF8 decodes the UTF-8 text in b and writes it to the buffer. Incomplete
+// characters at the end of b are kept until the next call.
+func (p *ANSI) putUTF8(b []byte) (err error) {
+	if len(p.partial) > 0 {
+		b = append(append([]byte(nil), p.partial...), b...)
+		p.partial = p.partial[:0]
+	}
+	for len(b) > 0 && err == nil {
+		if !utf8.FullRune(b) {
+			p.partial = append(p.partial, b...)
+			break
+		}
+		r, n := utf8.DecodeRune(b)
+		b = b[n:]
+		err = p.putRune(r)
+	}
+	return
+}
+
+// putRune writes a Unicode character to the buffer, wide characters occupy two
+// tiles and zero-width characters are combined with the previous character.
+func (p *ANSI) putRune(r rune) error {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me) || r == ZWNJ || r == ZWJ || r == VS16:
+		return p.buffer.Combine(r)
+	case isWide(r):
+		return p.buffer.PutWide(r)
+	default:
+		c, _ := p.codepage.Charmap.EncodeRune(r)
+		return p.buffer.PutRune(r, c)
+	}
+}
+
+// isWide checks if r is a double width East Asian character.
+func isWide(r rune) bool {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return true
+	}
+	return false
+}
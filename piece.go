@@ -1,18 +1,48 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/tehmaze-labs/go-piece/buffer"
+	"github.com/tehmaze-labs/go-piece/music"
 	"github.com/tehmaze-labs/go-piece/parser"
 	"github.com/tehmaze-labs/go-sauce"
 )
 
+// Number of bytes inspected to detect the width and encoding
+const detectSize = 1 << 16
+
 func main() {
-	flag.Parse()
 	format := flag.String("format", "html", "Output format")
+	screen := flag.Bool("screen", false, "Emulate a terminal screen with scrollback")
+	profile := flag.String("profile", parser.DefaultProfile.Name, "Emulation profile (ansi.sys, syncterm, xterm, netrunner)")
+	tunes := flag.String("music", "", "Export ANSI music to a .wav or .mid file")
+	unicode := flag.String("utf8", "auto", "Decode text as UTF-8 (auto, on, off)")
+	codepage := flag.String("codepage", "", "Code page, overrides the SAUCE font (cp437, cp866, amiga, ...)")
+	flag.Parse()
+
+	emulation, ok := parser.LookupProfile(*profile)
+	if !ok {
+		log.Fatalf("Unknown profile %q\n", *profile)
+	}
+	var override parser.CodePage
+	if *codepage != "" {
+		if override, ok = parser.LookupCodePage(*codepage); !ok {
+			log.Fatalf("Unknown code page %q\n", *codepage)
+		}
+	}
+	switch *unicode {
+	case "auto", "on", "off":
+	default:
+		log.Fatalf("Invalid -utf8 value %q\n", *unicode)
+	}
 
 	for _, filename := range flag.Args() {
 		f, err := os.Open(filename)
@@ -21,7 +51,9 @@ func main() {
 		}
 		defer f.Close()
 
-		w, h := 80, 25
+		w, h := 0, 25
+		utf8 := *unicode == "on"
+		cp := parser.DefaultCodePage
 
 		s, err := sauce.Parse(filename)
 		if err != nil {
@@ -36,11 +68,62 @@ func main() {
 					w = int(s.TInfo[0])
 				}
 			}
+			if font := s.TInfoS; font != "" && *codepage == "" {
+				if c, ok := parser.LookupFont(font); ok {
+					log.Printf("%s: font %q, using code page %s\n", filename, font, c.Name)
+					cp = c
+				} else {
+					log.Printf("%s: unknown font %q, using code page %s\n", filename, font, cp.Name)
+				}
+			}
+		}
+
+		r := bufio.NewReaderSize(f, detectSize)
+		b, _ := r.Peek(detectSize)
+		if w == 0 {
+			var confidence float64
+			w, confidence = parser.DetectWidth(b)
+			log.Printf("%s: guessed width %d (%.0f%% confidence)\n", filename, w, confidence*100)
 		}
 
 		log.Printf("creating %d x %d buffer\n", w, h)
 		p := parser.NewANSI(w, h)
-		p.Parse(f)
+		p.SetLimits(parser.DefaultLimits)
+		p.Diagnostics = parser.DiagnosticFunc(func(d *parser.Diagnostic) {
+			log.Printf("%s: %s\n", filename, d)
+		})
+		p.SetProfile(emulation)
+		if override.Charmap != nil {
+			cp = override
+		}
+		p.SetCodePage(cp)
+		if *screen {
+			p.Buffer().SetMode(buffer.MODE_SCREEN)
+		}
+		if *unicode == "auto" && !utf8 {
+			utf8 = parser.DetectUTF8(b)
+		}
+		if utf8 {
+			log.Printf("%s: decoding text as UTF-8\n", filename)
+		}
+		p.SetUTF8(utf8)
+		if err = p.Parse(r); err != nil {
+			var limit *buffer.LimitError
+			if errors.As(err, &limit) {
+				log.Printf("%s: parsing stopped early: %v\n", filename, err)
+			} else {
+				log.Printf("%s: failed to parse: %v\n", filename, err)
+			}
+		}
+
+		sw, sh := p.Buffer().SizeMax()
+		log.Printf("screen at %d x %d\n", sw, sh)
+
+		if *tunes != "" && len(p.Music) > 0 {
+			if err = exportMusic(*tunes, p.Music); err != nil {
+				log.Printf("%s: failed to export music: %v\n", filename, err)
+			}
+		}
 
 		switch *format {
 		case "html":
@@ -52,3 +135,18 @@ func main() {
 		}
 	}
 }
+
+func exportMusic(filename string, tunes []*music.Tune) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mid", ".midi":
+		return music.WriteMIDI(f, tunes...)
+	default:
+		return music.WriteWAV(f, music.WAV_DEFAULT_RATE, tunes...)
+	}
+}